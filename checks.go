@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// getLastCommitCheckState returns the combined status check state of a pull
+// request's last commit, or nil if it had no checks.
+func getLastCommitCheckState(ctx context.Context, client graphqlQuerier, owner string, repo string, number int) (*githubv4.StatusState, error) {
+	var query struct {
+		Repository struct {
+			PullRequest struct {
+				Commits struct {
+					Nodes []struct {
+						Commit struct {
+							StatusCheckRollup *struct {
+								State githubv4.StatusState
+							}
+						}
+					}
+				} `graphql:"commits(last: 1)"`
+			} `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
+	}
+	variables := map[string]interface{}{
+		"repositoryOwner": githubv4.String(owner),
+		"repositoryName":  githubv4.String(repo),
+		"number":          githubv4.Int(number),
+	}
+	if err := client.Query(ctx, &query, variables); err != nil {
+		return nil, err
+	}
+	nodes := query.Repository.PullRequest.Commits.Nodes
+	if len(nodes) == 0 || nodes[0].Commit.StatusCheckRollup == nil {
+		return nil, nil
+	}
+	return &nodes[0].Commit.StatusCheckRollup.State, nil
+}
+
+// checkMergedPrChecks returns why a merged pull request's last commit didn't
+// pass its checks, or an empty string if every one passed or had no checks.
+func checkMergedPrChecks(ctx context.Context, client graphqlQuerier, owner string, repo string, prs pullRequests) (string, error) {
+	for _, pr := range prs {
+		if !pr.Merged {
+			continue
+		}
+		state, err := getLastCommitCheckState(ctx, client, owner, repo, pr.Number)
+		if err != nil {
+			return "", err
+		}
+		if state != nil && *state != githubv4.StatusStateSuccess {
+			return fmt.Sprintf("merged with %s checks on #%d", *state, pr.Number), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeownersPaths are the locations Github reads a CODEOWNERS file from, in the
+// order it checks them.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// codeowners maps paths to their owners. As in gitignore, the last matching
+// rule wins.
+type codeowners []codeownersRule
+
+// loadCodeowners reads the first CODEOWNERS file found in the repository root.
+func loadCodeowners(root string) (codeowners, error) {
+	for _, path := range codeownersPaths {
+		file, err := os.Open(filepath.Join(root, path))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseCodeowners(file.Name(), bufio.NewScanner(file))
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file found in %s", strings.Join(codeownersPaths, ", "))
+}
+
+func parseCodeowners(name string, scanner *bufio.Scanner) (codeowners, error) {
+	var rules codeowners
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern, err := codeownersPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		rules = append(rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return rules, scanner.Err()
+}
+
+// codeownersPattern converts a CODEOWNERS path pattern to a regular expression
+// matching the paths it covers. Patterns containing a slash other than a
+// trailing one are anchored to the repository root. A pattern also covers
+// everything under a matched directory, unless its last segment has a wildcard:
+// docs/* matches the files in docs but not those in its subdirectories.
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	directory := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	lastSegment := pattern[strings.LastIndex(pattern, "/")+1:]
+	directory = directory || !strings.Contains(lastSegment, "*")
+
+	var sb strings.Builder
+	if anchored {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			sb.WriteString("[^/]*")
+		case pattern[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if directory {
+		sb.WriteString("(/.*)?")
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// owners returns the owners of the path from the last matching rule.
+func (c codeowners) owners(path string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.MatchString(path) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// ownsAll reports whether owner, a login or @org/team, owns every one of the
+// files.
+func (c codeowners) ownsAll(owner string, files []string) bool {
+	owner = strings.TrimPrefix(owner, "@")
+	for _, file := range files {
+		owned := false
+		for _, fileOwner := range c.owners(file) {
+			if strings.EqualFold(strings.TrimPrefix(fileOwner, "@"), owner) {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			return false
+		}
+	}
+	return true
+}
+
+// touchedProtectedPath returns the first file changed on branch since it
+// diverged from base that matches one of the patterns, or an empty string.
+func touchedProtectedPath(ctx context.Context, patterns []*regexp.Regexp, base string, branch string) (string, error) {
+	files, err := getChangedFiles(ctx, base, branch)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		for _, pattern := range patterns {
+			if pattern.MatchString(file) {
+				return file, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// ownedByTeam reports whether every file the branch changed since it diverged
+// from base is owned by owner. Branches that change nothing aren't owned.
+func ownedByTeam(ctx context.Context, rules codeowners, owner string, base string, branch string) (bool, error) {
+	files, err := getChangedFiles(ctx, base, branch)
+	if err != nil {
+		return false, err
+	}
+	return len(files) > 0 && rules.ownsAll(owner, files), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCodeownersPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "*", path: "README.md", want: true},
+		{pattern: "*", path: "docs/build-app/troubleshooting.md", want: true},
+		{pattern: "*.js", path: "app.js", want: true},
+		{pattern: "*.js", path: "src/lib/app.js", want: true},
+		{pattern: "*.js", path: "src/app.ts", want: false},
+		{pattern: "docs/*", path: "docs/getting-started.md", want: true},
+		{pattern: "docs/*", path: "docs/build-app/troubleshooting.md", want: false},
+		{pattern: "docs/*", path: "src/docs/getting-started.md", want: false},
+		{pattern: "/docs/*", path: "docs/getting-started.md", want: true},
+		{pattern: "/docs/*", path: "docs/build-app/troubleshooting.md", want: false},
+		{pattern: "docs/**", path: "docs/build-app/troubleshooting.md", want: true},
+		{pattern: "docs/", path: "docs/build-app/troubleshooting.md", want: true},
+		{pattern: "docs/", path: "src/docs/getting-started.md", want: true},
+		{pattern: "/docs/", path: "src/docs/getting-started.md", want: false},
+		{pattern: "docs", path: "docs/getting-started.md", want: true},
+		{pattern: "apps/github", path: "apps/github/index.js", want: true},
+		{pattern: "apps/github", path: "src/apps/github/index.js", want: false},
+		{pattern: "**/logs", path: "build/logs/today.log", want: true},
+		{pattern: "**/logs", path: "logs/today.log", want: true},
+		{pattern: "docs/*/", path: "docs/build-app/troubleshooting.md", want: true},
+		{pattern: "file?.txt", path: "dir/file1.txt", want: true},
+	}
+	for _, test := range tests {
+		re, err := codeownersPattern(test.pattern)
+		if err != nil {
+			t.Fatalf("codeownersPattern(%q) error = %v", test.pattern, err)
+		}
+		if got := re.MatchString(test.path); got != test.want {
+			t.Errorf("codeownersPattern(%q) matches %q = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestCodeownersNestedFilesKeepTheirOwners(t *testing.T) {
+	rules, err := parseCodeowners("CODEOWNERS", bufio.NewScanner(strings.NewReader("* @org/everyone\ndocs/* @me\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rules.owners("docs/index.md"); !slices.Equal(got, []string{"@me"}) {
+		t.Errorf("owners(docs/index.md) = %q, want [@me]", got)
+	}
+	if got := rules.owners("docs/build-app/troubleshooting.md"); !slices.Equal(got, []string{"@org/everyone"}) {
+		t.Errorf("owners(docs/build-app/troubleshooting.md) = %q, want [@org/everyone]", got)
+	}
+	if rules.ownsAll("@me", []string{"docs/index.md", "docs/build-app/troubleshooting.md"}) {
+		t.Error("ownsAll(@me) = true for a nested file owned by @org/everyone")
+	}
+	if !rules.ownsAll("@me", []string{"docs/index.md"}) {
+		t.Error("ownsAll(@me) = false for a file it owns")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const defaultConfigFile = ".delete-old-branches.json"
+
+// config is the on-disk configuration. Each profile maps flag names (without
+// the leading dash) to values, for example:
+//
+//	{"profiles": {"aggressive": {"force": true, "older-than": "168h"}}}
+type config struct {
+	Profiles map[string]map[string]json.RawMessage `json:"profiles"`
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// applyProfile sets every flag in the named profile that wasn't explicitly
+// passed on the command line, so CLI flags always take precedence.
+func applyProfile(configPath string, profile string) error {
+	if profile == "" {
+		return nil
+	}
+	cfg, err := loadConfig(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("profile %q requested but config file %s does not exist", profile, configPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	options, ok := cfg.Profiles[profile]
+	if !ok {
+		return fmt.Errorf("profile %q not found in %s, available profiles: %s", profile, configPath, strings.Join(cfg.profileNames(), ", "))
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, raw := range options {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("profile %q sets unknown flag %q", profile, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		value := string(raw)
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			value = str
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("profile %q has invalid value for %q: %w", profile, name, err)
+		}
+	}
+	return nil
+}
+
+func (c *config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
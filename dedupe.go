@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// prGroups caches pull request lookups by head ref and groups the branches
+// that resolve to the same set of pull requests, which happens when several
+// branches are mapped onto one head ref with -strip-prefix or -branch-map.
+type prGroups struct {
+	queries  map[string]pullRequests
+	branches map[string][]string
+	order    []string
+}
+
+func newPrGroups() *prGroups {
+	return &prGroups{
+		queries:  make(map[string]pullRequests),
+		branches: make(map[string][]string),
+	}
+}
+
+// lookup returns the pull requests for the head ref, only querying Github the
+// first time each head ref is seen.
+func (g *prGroups) lookup(ctx context.Context, client graphqlQuerier, owner string, repo string, headRef string, lookback time.Duration, pageSize int, headOwner string) (pullRequests, error) {
+	if prs, ok := g.queries[headRef]; ok {
+		return prs, nil
+	}
+	prs, err := getAllPullRequests(ctx, client, owner, repo, headRef, lookback, pageSize, headOwner)
+	if err != nil {
+		return nil, err
+	}
+	g.queries[headRef] = prs
+	return prs, nil
+}
+
+// add records the branch under its pull request set and returns the branch
+// first seen with the same set, if any.
+func (g *prGroups) add(branch string, prs pullRequests) string {
+	key := prNumberKey(prs)
+	if key == "" {
+		return ""
+	}
+	existing := g.branches[key]
+	if existing == nil {
+		g.order = append(g.order, key)
+	}
+	g.branches[key] = append(existing, branch)
+	if len(existing) > 0 {
+		return existing[0]
+	}
+	return ""
+}
+
+// report prints each pull request set shared by more than one branch.
+func (g *prGroups) report() {
+	for _, key := range g.order {
+		if branches := g.branches[key]; len(branches) > 1 {
+			logf("Pull requests %s are shared by branches: %s\n", key, strings.Join(branches, ", "))
+		}
+	}
+}
+
+// prNumberKey returns the sorted pull request numbers, such as "#3, #12".
+func prNumberKey(prs pullRequests) string {
+	numbers := make([]int, 0, len(prs))
+	for _, pr := range prs {
+		numbers = append(numbers, pr.Number)
+	}
+	sort.Ints(numbers)
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = fmt.Sprintf("#%d", number)
+	}
+	return strings.Join(parts, ", ")
+}
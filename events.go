@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+const (
+	actionDeleted     = "deleted"
+	actionWouldDelete = "would-delete"
+	actionKept        = "kept"
+	actionError       = "error"
+)
+
+type branchEvent struct {
+	RunID     string    `json:"run_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Branch    string    `json:"branch"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+}
+
+// eventLog appends one JSON line per branch decision as it happens. A nil
+// *eventLog is valid and discards all events.
+type eventLog struct {
+	file    *os.File
+	encoder *json.Encoder
+	runID   string
+}
+
+func openEventLog(path string, runID string) (*eventLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{file: file, encoder: json.NewEncoder(file), runID: runID}, nil
+}
+
+func (l *eventLog) record(branch string, action string, reason string) {
+	if l == nil {
+		return
+	}
+	event := branchEvent{
+		RunID:     l.runID,
+		Timestamp: time.Now().UTC(),
+		Branch:    branch,
+		Action:    action,
+		Reason:    reason,
+	}
+	if err := l.encoder.Encode(event); err != nil {
+		logf("Failed to write event for branch %s: %v\n", branch, err)
+		return
+	}
+	if err := l.file.Sync(); err != nil {
+		logf("Failed to flush event for branch %s: %v\n", branch, err)
+	}
+}
+
+func (l *eventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+// decisionTrace collects the conditions evaluated for the branch currently
+// being considered, printed alongside the final decision with -explain. A nil
+// *decisionTrace is valid and records nothing.
+type decisionTrace struct {
+	steps []string
+}
+
+func (t *decisionTrace) check(condition string, result bool) {
+	if t == nil {
+		return
+	}
+	answer := "no"
+	if result {
+		answer = "yes"
+	}
+	t.steps = append(t.steps, fmt.Sprintf("%s? %s", condition, answer))
+}
+
+// print writes the collected conditions and the decision, then resets the
+// trace for the next branch.
+func (t *decisionTrace) print(branch string, action string, reason string) {
+	if t == nil {
+		return
+	}
+	logf("Decision trace for branch %s:\n", branch)
+	for _, step := range t.steps {
+		logf("  %s\n", step)
+	}
+	logf("  => %s (%s)\n", action, reason)
+	t.steps = nil
+}
+
+// take returns the conditions collected so far and resets the trace, for a
+// decision that's only recorded later.
+func (t *decisionTrace) take() []string {
+	if t == nil {
+		return nil
+	}
+	steps := t.steps
+	t.steps = nil
+	return steps
+}
+
+// restore replaces the collected conditions with steps returned by take.
+func (t *decisionTrace) restore(steps []string) {
+	if t == nil {
+		return
+	}
+	t.steps = steps
+}
@@ -0,0 +1,16 @@
+package main
+
+import "strings"
+
+// stringListFlag is a flag.Value that collects every occurrence of a
+// repeatable flag.
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
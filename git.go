@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitCommand builds a git command that never pages output or prompts for
+// credentials, so it is safe to run unattended.
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager"}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_PAGER=cat", "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+func getBranches(ctx context.Context) (branches, error) {
+	cmd := gitCommand(ctx, "branch", "-l")
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	branchList := strings.Split(string(output), "\n")
+	return branchList, err
+}
+
+// commandOutput runs the command and returns its standard output. On failure
+// the command's error output is included in the error, since it usually
+// explains what went wrong.
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output, withStderr(err, string(exitErr.Stderr))
+	}
+	return output, err
+}
+
+func withStderr(err error, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if err == nil || stderr == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, stderr)
+}
+
+// branchExists reports whether a local branch with the given name exists.
+func branchExists(ctx context.Context, branch string) (bool, error) {
+	return refExists(ctx, "refs/heads/"+branch)
+}
+
+// refExists reports whether the fully qualified ref exists.
+func refExists(ctx context.Context, ref string) (bool, error) {
+	cmd := gitCommand(ctx, "rev-parse", "--verify", "--quiet", ref)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// getCurrentBranch returns the branch checked out in the working tree, or an
+// empty string when HEAD is detached.
+func getCurrentBranch(ctx context.Context) (string, error) {
+	output, err := commandOutput(gitCommand(ctx, "branch", "--show-current"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// isDetachedHead reports whether HEAD points directly at a commit rather than
+// at a branch.
+func isDetachedHead(ctx context.Context) (bool, error) {
+	err := gitCommand(ctx, "symbolic-ref", "-q", "HEAD").Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+func isShallowRepository(ctx context.Context) (bool, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-parse", "--is-shallow-repository"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
+func unshallowRepository(ctx context.Context, remote string) error {
+	_, err := commandOutput(gitCommand(ctx, "fetch", "--unshallow", remote))
+	return err
+}
+
+// getRemoteBranches returns the names of the remote's branches as last fetched,
+// without the remote prefix.
+func getRemoteBranches(ctx context.Context, remote string) (branches, error) {
+	cmd := gitCommand(ctx, "for-each-ref", "--format=%(refname:lstrip=3)", "refs/remotes/"+remote+"/")
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var remoteBranches branches
+	for _, branch := range strings.Split(string(output), "\n") {
+		if branch != "" && branch != "HEAD" {
+			remoteBranches = append(remoteBranches, branch)
+		}
+	}
+	return remoteBranches, nil
+}
+
+// getLastCommitTime returns the committer date of the tip of the given branch.
+func getLastCommitTime(ctx context.Context, branch string) (time.Time, error) {
+	cmd := gitCommand(ctx, "log", "-1", "--format=%ct", branch, "--")
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// branchInfo describes the tip of a branch for reports.
+type branchInfo struct {
+	Author     string    `json:"author"`
+	LastCommit time.Time `json:"last_commit"`
+	Ahead      int       `json:"ahead"`
+	Behind     int       `json:"behind"`
+}
+
+// getBranchInfo reads the last commit author and date of every ref under the
+// given prefixes in a single for-each-ref call, keyed by the branch name as
+// displayed, such as main or origin/main.
+func getBranchInfo(ctx context.Context, prefixes ...string) (map[string]branchInfo, error) {
+	args := append([]string{"for-each-ref", "--format=%(refname)%00%(authorname)%00%(committerdate:unix)"}, prefixes...)
+	output, err := commandOutput(gitCommand(ctx, args...))
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]branchInfo)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing commit date of %s: %w", fields[0], err)
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(fields[0], "refs/heads/"), "refs/remotes/")
+		infos[name] = branchInfo{Author: fields[1], LastCommit: time.Unix(seconds, 0)}
+	}
+	return infos, nil
+}
+
+// countAheadBehind returns the number of commits on branch that aren't on base,
+// and on base that aren't on branch.
+func countAheadBehind(ctx context.Context, base string, branch string) (int, int, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-list", "--left-right", "--count", base+"..."+branch, "--"))
+	if err != nil {
+		return 0, 0, err
+	}
+	var behind, ahead int
+	if _, err := fmt.Sscanf(string(output), "%d\t%d", &behind, &ahead); err != nil {
+		return 0, 0, fmt.Errorf("parsing rev-list output %q: %w", strings.TrimSpace(string(output)), err)
+	}
+	return ahead, behind, nil
+}
+
+// getTagsPointingAt returns the tags that point at the tip of the given branch.
+func getTagsPointingAt(ctx context.Context, branch string) ([]string, error) {
+	cmd := gitCommand(ctx, "tag", "--points-at", branch)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// getCommit resolves the ref to a full commit hash.
+func getCommit(ctx context.Context, ref string) (string, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-parse", "--verify", ref+"^{commit}"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// getUpstream returns the upstream ref the branch tracks, or an empty string if
+// it has none or the upstream no longer exists.
+func getUpstream(ctx context.Context, branch string) (string, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", branch+"@{upstream}"))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// countCommitsAhead returns the number of commits on branch that aren't on base.
+func countCommitsAhead(ctx context.Context, branch string, base string) (int, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-list", "--count", branch, "^"+base, "--"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// countCommitsNotOnRemotes counts the commits of branch that aren't reachable
+// from any remote-tracking branch.
+func countCommitsNotOnRemotes(ctx context.Context, branch string) (int, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-list", "--count", branch, "--not", "--remotes", "--"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// getStashes returns the stash entries made on each branch, keyed by branch
+// name, such as stash@{0}.
+func getStashes(ctx context.Context) (map[string][]string, error) {
+	output, err := commandOutput(gitCommand(ctx, "stash", "list", "--format=%gd%x00%gs"))
+	if err != nil {
+		return nil, err
+	}
+	return parseStashList(string(output)), nil
+}
+
+// parseStashList parses git stash list lines of a stash ref and its subject,
+// separated by NUL. Git writes the subject as "WIP on <branch>: ..." for plain
+// stashes and "On <branch>: ..." for stashes with a message. Ref names can't
+// contain a colon, so the branch ends at the first one.
+func parseStashList(output string) map[string][]string {
+	stashes := make(map[string][]string)
+	for _, line := range strings.Split(output, "\n") {
+		ref, subject, ok := strings.Cut(line, "\x00")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(subject, "WIP on ")
+		if !ok {
+			rest, ok = strings.CutPrefix(subject, "On ")
+		}
+		if !ok {
+			continue
+		}
+		branch, _, ok := strings.Cut(rest, ": ")
+		if !ok || branch == "(no branch)" {
+			continue
+		}
+		stashes[branch] = append(stashes[branch], ref)
+	}
+	return stashes
+}
+
+// isAncestor reports whether commit is reachable from target.
+func isAncestor(ctx context.Context, commit string, target string) (bool, error) {
+	err := gitCommand(ctx, "merge-base", "--is-ancestor", commit, target).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getRemoteHead returns the branch that refs/remotes/<remote>/HEAD points at.
+func getRemoteHead(ctx context.Context, remote string) (string, error) {
+	output, err := commandOutput(gitCommand(ctx, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(output)), remote+"/"), nil
+}
+
+// upstreamState is the configured upstream of a local branch. Gone is set
+// when the upstream is configured but its remote-tracking branch no longer
+// exists, usually because it was deleted on the remote and pruned.
+type upstreamState struct {
+	Upstream string
+	Gone     bool
+}
+
+// getUpstreamStates returns the upstream of every local branch that has one,
+// keyed by branch name.
+func getUpstreamStates(ctx context.Context) (map[string]upstreamState, error) {
+	output, err := commandOutput(gitCommand(ctx, "for-each-ref", "--format=%(refname:short)%00%(upstream:short)%00%(upstream:track,nobracket)", "refs/heads/"))
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]upstreamState)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 || fields[1] == "" {
+			continue
+		}
+		states[fields[0]] = upstreamState{Upstream: fields[1], Gone: fields[2] == "gone"}
+	}
+	return states, nil
+}
+
+// getRemoteHeads returns the names of every branch on the remote, asking the
+// remote itself rather than trusting remote-tracking branches.
+func getRemoteHeads(ctx context.Context, remote string) (map[string]bool, error) {
+	output, err := commandOutput(gitCommand(ctx, "ls-remote", "--heads", remote))
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if _, ref, ok := strings.Cut(line, "\t"); ok {
+			heads[strings.TrimPrefix(ref, "refs/heads/")] = true
+		}
+	}
+	return heads, nil
+}
+
+// getRemoteBranchTip returns the commit the branch points at on the remote, or
+// an empty string if the remote doesn't have the branch.
+func getRemoteBranchTip(ctx context.Context, remote string, branch string) (string, error) {
+	cmd := gitCommand(ctx, "ls-remote", "--heads", remote, "refs/heads/"+branch)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return "", err
+	}
+	sha, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\t")
+	return sha, nil
+}
+
+// isRemoteBranchActive reports whether the branch still exists on the remote
+// and its tip was committed within the window. A tip that hasn't been fetched
+// locally can't be dated, so it is treated as active.
+func isRemoteBranchActive(ctx context.Context, remote string, branch string, window time.Duration) (bool, string, error) {
+	sha, err := getRemoteBranchTip(ctx, remote, branch)
+	if err != nil || sha == "" {
+		return false, "", err
+	}
+	lastCommit, err := getLastCommitTime(ctx, sha)
+	if err != nil {
+		return true, fmt.Sprintf("exists on %s at unfetched commit %.7s (run git fetch)", remote, sha), nil
+	}
+	if age := time.Since(lastCommit); age < window {
+		return true, fmt.Sprintf("was updated on %s %v ago", remote, age.Round(time.Minute)), nil
+	}
+	return false, "", nil
+}
+
+// getChangedFiles returns the files changed on branch since it diverged from
+// base.
+func getChangedFiles(ctx context.Context, base string, branch string) ([]string, error) {
+	output, err := commandOutput(gitCommand(ctx, "diff", "--name-only", "-z", base+"..."+branch, "--"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// getRepositoryRoot returns the top level directory of the working tree.
+func getRepositoryRoot(ctx context.Context) (string, error) {
+	output, err := commandOutput(gitCommand(ctx, "rev-parse", "--show-toplevel"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+const maxDiffStatFiles = 10
+
+// printDiffStat prints the files changed on the branch since it diverged from base, usually the
+// default branch, truncated to maxDiffStatFiles entries followed by git's summary line.
+func printDiffStat(ctx context.Context, base string, branch string) {
+	cmd := gitCommand(ctx, "diff", "--stat=100", base+"..."+branch, "--")
+	output, err := commandOutput(cmd)
+	if err != nil {
+		logf("Failed to get diff stat for branch %s: %v\n", branch, err)
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		logf("Branch %s has no changes relative to %s\n", branch, base)
+		return
+	}
+	summary := strings.TrimSpace(lines[len(lines)-1])
+	files := lines[:len(lines)-1]
+	logf("Branch %s contributed: %s\n", branch, summary)
+	for i, file := range files {
+		if i == maxDiffStatFiles {
+			logf("   ... and %d more files\n", len(files)-maxDiffStatFiles)
+			break
+		}
+		logf("  %s\n", file)
+	}
+}
+
+func deleteBranch(ctx context.Context, branch string, safeMode bool, safeDelete bool) error {
+	logf("Deleting branch: %s\n", branch)
+	if safeMode {
+		logf("Safe mode enabled, skipping deletion...\n")
+	} else {
+		stderr, err := runBranchDelete(ctx, []string{branch}, safeDelete)
+		if err != nil && isGitLockError(stderr) {
+			logf("Branch %s is locked by another git process, retrying in %v...\n", branch, lockRetryDelay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(lockRetryDelay):
+			}
+			stderr, err = runBranchDelete(ctx, []string{branch}, safeDelete)
+			if err != nil && isGitLockError(stderr) {
+				logf("Failed to delete branch %s, it is still locked by another git process: %v\n", branch, err)
+				return err
+			}
+		}
+		if err != nil && safeDelete && strings.Contains(stderr, "is not fully merged") {
+			logf("Git refused to delete branch %s because it is not fully merged into HEAD\n", branch)
+			return err
+		}
+		if err != nil {
+			logf("Failed to delete branch %s: %v\n", branch, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBranches deletes local branches with a single git branch command,
+// returning the error for each branch that wasn't deleted. If the command
+// fails, branches that still exist are deleted one at a time to find out which
+// of them failed and why.
+func deleteBranches(ctx context.Context, branches []string, safeDelete bool) map[string]error {
+	logf("Deleting %d branches: %s\n", len(branches), strings.Join(branches, " "))
+	failed := make(map[string]error)
+	_, err := runBranchDelete(ctx, branches, safeDelete)
+	if err == nil {
+		return failed
+	}
+	logf("Failed to delete branches together, deleting the rest one at a time: %v\n", err)
+	for _, branch := range branches {
+		if exists, err := branchExists(ctx, branch); err == nil && !exists {
+			continue
+		}
+		if err := deleteBranch(ctx, branch, false, safeDelete); err != nil {
+			failed[branch] = err
+		}
+	}
+	return failed
+}
+
+// deleteRemoteBranch deletes the branch on the remote with git push, passing
+// the extra arguments to it before the remote.
+func deleteRemoteBranch(ctx context.Context, remote string, branch string, safeMode bool, extraArgs []string) error {
+	logf("Deleting remote branch: %s/%s\n", remote, branch)
+	if safeMode {
+		logf("Safe mode enabled, skipping deletion...\n")
+		return nil
+	}
+	if _, err := commandOutput(gitCommand(ctx, append(append([]string{"push"}, extraArgs...), remote, "--delete", branch)...)); err != nil {
+		logf("Failed to delete remote branch %s/%s: %v\n", remote, branch, err)
+		return err
+	}
+	return nil
+}
+
+const lockRetryDelay = time.Second
+
+// runBranchDelete deletes the branch, using git's own merge check with -d
+// when safeDelete is set rather than forcing the deletion with -D.
+func runBranchDelete(ctx context.Context, branches []string, safeDelete bool) (string, error) {
+	deleteFlag := "-D"
+	if safeDelete {
+		deleteFlag = "-d"
+	}
+	var stderr bytes.Buffer
+	args := append([]string{"branch", deleteFlag, "--"}, branches...)
+	deleteCmd := gitCommand(ctx, args...)
+	deleteCmd.Stderr = &stderr
+	err := deleteCmd.Run()
+	return stderr.String(), withStderr(err, stderr.String())
+}
+
+// deniedDeleteArgs are git push options that would change what a remote
+// delete acts on, such as pushing other refs, force pushing, sending the push
+// to another repository or running another command on the remote.
+var deniedDeleteArgs = []string{
+	"--all", "--branches", "-f", "--force", "--force-with-lease", "--mirror", "--prune", "--tags", "--follow-tags",
+	"-d", "--delete", "--repo", "--receive-pack", "--exec", "-o", "--push-option",
+}
+
+// checkExtraDeleteArgs rejects extra git arguments that aren't options or that
+// are in deniedDeleteArgs. Each letter of a group of short options, such as
+// -qf, is checked on its own.
+func checkExtraDeleteArgs(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return fmt.Errorf("%q is not an option, only git options can follow --", arg)
+		}
+		var names []string
+		if long, ok := strings.CutPrefix(arg, "--"); ok {
+			name, _, _ := strings.Cut(long, "=")
+			names = append(names, "--"+name)
+		} else {
+			for _, letter := range arg[1:] {
+				names = append(names, "-"+string(letter))
+			}
+		}
+		for _, name := range names {
+			if slices.Contains(deniedDeleteArgs, name) {
+				return fmt.Errorf("%s can't be passed to git push", name)
+			}
+		}
+	}
+	return nil
+}
+
+// isGitLockError reports whether git's error output indicates a lock file
+// (such as .git/index.lock or a ref lock) held by another git process.
+func isGitLockError(stderr string) bool {
+	return strings.Contains(stderr, ".lock': File exists")
+}
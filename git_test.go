@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGitCommandDisablesPagerAndPrompts(t *testing.T) {
+	cmd := gitCommand(context.Background(), "log", "--oneline")
+
+	wantArgs := []string{"git", "--no-pager", "log", "--oneline"}
+	if !reflect.DeepEqual(cmd.Args, wantArgs) {
+		t.Errorf("gitCommand() args = %q, want %q", cmd.Args, wantArgs)
+	}
+	for _, env := range []string{"GIT_PAGER=cat", "GIT_TERMINAL_PROMPT=0"} {
+		if !slices.Contains(cmd.Env, env) {
+			t.Errorf("gitCommand() env is missing %s", env)
+		}
+	}
+}
+
+func TestParseStashList(t *testing.T) {
+	output := "stash@{0}\x00WIP on feature/login: 1a2b3c4 Add login form\n" +
+		"stash@{1}\x00On main: tidy up before release\n" +
+		"stash@{2}\x00On feature/login: try another layout\n" +
+		"stash@{3}\x00WIP on (no branch): 5d6e7f8 Bisecting\n" +
+		"stash@{4}\x00autostash\n" +
+		"\n"
+
+	got := parseStashList(output)
+	want := map[string][]string{
+		"feature/login": {"stash@{0}", "stash@{2}"},
+		"main":          {"stash@{1}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStashList() = %v, want %v", got, want)
+	}
+}
+
+func TestParseStashListEmpty(t *testing.T) {
+	if got := parseStashList(""); len(got) != 0 {
+		t.Errorf("parseStashList(\"\") = %v, want no stashes", got)
+	}
+}
+
+func TestCheckExtraDeleteArgs(t *testing.T) {
+	allowed := [][]string{
+		nil,
+		{"--no-verify"},
+		{"-q", "--atomic"},
+		{"--signed=if-asked"},
+	}
+	for _, args := range allowed {
+		if err := checkExtraDeleteArgs(args); err != nil {
+			t.Errorf("checkExtraDeleteArgs(%q) error = %v, want it allowed", args, err)
+		}
+	}
+
+	denied := [][]string{
+		{"origin"},
+		{"-"},
+		{"--force"},
+		{"--force-with-lease=main"},
+		{"-qf"},
+		{"--repo=https://example.com/other.git"},
+		{"--receive-pack=rm -rf /"},
+		{"--exec=sh"},
+		{"-o", "ci.skip"},
+		{"-oci.skip"},
+		{"--push-option=ci.skip"},
+		{"--mirror"},
+		{"--all"},
+	}
+	for _, args := range denied {
+		if err := checkExtraDeleteArgs(args); err == nil {
+			t.Errorf("checkExtraDeleteArgs(%q) = nil, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findGitDir walks up from the working directory to find the repository's git
+// directory, following the `gitdir:` pointer used by worktrees and submodules.
+func findGitDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			if info.IsDir() {
+				return gitPath, nil
+			}
+			return readGitDirFile(gitPath)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not inside a git repository")
+		}
+		dir = parent
+	}
+}
+
+func readGitDirFile(gitPath string) (string, error) {
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s does not contain a gitdir", gitPath)
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(gitPath), gitDir)
+	}
+	return gitDir, nil
+}
+
+// commonGitDir returns the directory holding the shared config and refs, which
+// differs from the git directory for linked worktrees.
+func commonGitDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	commonDir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return commonDir
+}
+
+// gitConfigEntry is a single key and value from a git config file, with the
+// section and subsection it appeared under such as remote and "origin".
+type gitConfigEntry struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+}
+
+// readGitConfig reads the entries of a git config file. Section and key names
+// are lowercased, as git treats them case-insensitively.
+func readGitConfig(configPath string) ([]gitConfigEntry, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []gitConfigEntry
+	var section, subsection string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name, sub, _ := strings.Cut(strings.TrimSpace(line[1:len(line)-1]), " ")
+			section = strings.ToLower(name)
+			subsection = strings.Trim(strings.TrimSpace(sub), `"`)
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		entries = append(entries, gitConfigEntry{
+			Section:    section,
+			Subsection: subsection,
+			Key:        strings.ToLower(strings.TrimSpace(key)),
+			Value:      strings.Trim(strings.TrimSpace(value), `"`),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// getRemoteURLFromGitConfig reads the url of the named remote from a git
+// config file.
+func getRemoteURLFromGitConfig(configPath string, remote string) (string, error) {
+	entries, err := readGitConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.Section == "remote" && entry.Subsection == remote && entry.Key == "url" {
+			return entry.Value, nil
+		}
+	}
+	return "", fmt.Errorf("no url for remote %s in %s", remote, configPath)
+}
+
+// userGitConfigPaths returns the global git config files, which commonly hold
+// url.insteadOf rewrites.
+func userGitConfigPaths() []string {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "git", "config"))
+	}
+	return paths
+}
+
+// applyInsteadOf rewrites the remote URL using the longest matching
+// url.<base>.insteadOf prefix from the config files, as git does. Files that
+// don't exist are ignored.
+func applyInsteadOf(remoteURL string, configPaths ...string) (string, error) {
+	var base, prefix string
+	for _, configPath := range configPaths {
+		entries, err := readGitConfig(configPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			if entry.Section == "url" && entry.Key == "insteadof" && strings.HasPrefix(remoteURL, entry.Value) && len(entry.Value) > len(prefix) {
+				base, prefix = entry.Subsection, entry.Value
+			}
+		}
+	}
+	if prefix == "" {
+		return remoteURL, nil
+	}
+	return base + strings.TrimPrefix(remoteURL, prefix), nil
+}
+
+// remoteRepository is the host, owner and name of a repository parsed from a
+// remote URL.
+type remoteRepository struct {
+	Host  string
+	Owner string
+	Repo  string
+}
+
+// parseGithubRemoteURL extracts the host, owner and repository name from remote
+// URLs such as git@github.com:owner/repo.git, ssh://git@github.com/owner/repo.git
+// and https://github.example.com:8443/owner/repo. Ports are kept for http and
+// https URLs, where they also apply to the API, and dropped for ssh.
+func parseGithubRemoteURL(remoteURL string) (remoteRepository, error) {
+	var host, repoPath string
+	if strings.Contains(remoteURL, "://") {
+		parsed, err := url.Parse(remoteURL)
+		if err != nil {
+			return remoteRepository{}, fmt.Errorf("unsupported remote url %q: %w", remoteURL, err)
+		}
+		switch parsed.Scheme {
+		case "https", "http":
+			host = parsed.Host
+		case "ssh", "git", "git+ssh":
+			host = parsed.Hostname()
+		default:
+			return remoteRepository{}, fmt.Errorf("unsupported remote url scheme %q in %q", parsed.Scheme, remoteURL)
+		}
+		repoPath = strings.TrimPrefix(parsed.Path, "/")
+	} else if before, after, ok := strings.Cut(remoteURL, ":"); ok && before != "" && !strings.Contains(before, "/") {
+		// scp-like syntax, [user@]host:owner/repo
+		host = before[strings.LastIndex(before, "@")+1:]
+		repoPath = after
+	} else {
+		return remoteRepository{}, fmt.Errorf("unsupported remote url %q", remoteURL)
+	}
+
+	owner, repo, ok := strings.Cut(strings.TrimSuffix(strings.TrimSuffix(repoPath, "/"), ".git"), "/")
+	if host == "" || !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return remoteRepository{}, fmt.Errorf("remote url %q is not in owner/repo form", remoteURL)
+	}
+	return remoteRepository{Host: strings.ToLower(host), Owner: owner, Repo: repo}, nil
+}
+
+// getRemoteDefaultBranch reads the branch that refs/remotes/<remote>/HEAD
+// points at, as set by clone or `git remote set-head`.
+func getRemoteDefaultBranch(gitDir string, remote string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(gitDir, "refs", "remotes", remote, "HEAD"))
+	if err != nil {
+		return "", fmt.Errorf("reading %s/HEAD, try `git remote set-head %s --auto`: %w", remote, remote, err)
+	}
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/remotes/"+remote+"/")
+	if !ok {
+		return "", fmt.Errorf("unexpected contents of %s/HEAD: %q", remote, strings.TrimSpace(string(data)))
+	}
+	return ref, nil
+}
+
+// getRepoFromGitConfig detects the repository and default branch of the
+// remote by reading the git directory directly, without gh.
+func getRepoFromGitConfig(remoteName string) (remoteRepository, string, error) {
+	gitDir, err := findGitDir()
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+	return getRepoFromGitDir(commonGitDir(gitDir), remoteName)
+}
+
+// getRepoFromGitDir is getRepoFromGitConfig for the common git directory.
+func getRepoFromGitDir(commonDir string, remoteName string) (remoteRepository, string, error) {
+	configPath := filepath.Join(commonDir, "config")
+
+	remoteURL, err := getRemoteURLFromGitConfig(configPath, remoteName)
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+	remoteURL, err = applyInsteadOf(remoteURL, append(userGitConfigPaths(), configPath)...)
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+	remote, err := parseGithubRemoteURL(remoteURL)
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+	defaultBranch, err := getRemoteDefaultBranch(commonDir, remoteName)
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+	return remote, defaultBranch, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeGitConfig(t *testing.T, contents string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestParseGithubRemoteURLScpAndHttps(t *testing.T) {
+	want := remoteRepository{Host: "github.com", Owner: "liam-mackie", Repo: "delete-old-branches"}
+	for _, remoteURL := range []string{
+		"git@github.com:liam-mackie/delete-old-branches.git",
+		"git@github.com:liam-mackie/delete-old-branches",
+		"https://github.com/liam-mackie/delete-old-branches.git",
+		"https://github.com/liam-mackie/delete-old-branches",
+	} {
+		got, err := parseGithubRemoteURL(remoteURL)
+		if err != nil {
+			t.Errorf("parseGithubRemoteURL(%q) error = %v", remoteURL, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("parseGithubRemoteURL(%q) = %+v, want %+v", remoteURL, got, want)
+		}
+	}
+}
+
+func TestGetRemoteURLFromGitConfig(t *testing.T) {
+	configPath := writeGitConfig(t, `[core]
+	bare = false
+[remote "upstream"]
+	url = https://github.com/liam-mackie/delete-old-branches.git
+[remote "origin"]
+	url = git@github.com:someone/delete-old-branches.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`)
+
+	got, err := getRemoteURLFromGitConfig(configPath, "origin")
+	if err != nil {
+		t.Fatalf("getRemoteURLFromGitConfig() error = %v", err)
+	}
+	if want := "git@github.com:someone/delete-old-branches.git"; got != want {
+		t.Errorf("getRemoteURLFromGitConfig() = %q, want %q", got, want)
+	}
+
+	if _, err := getRemoteURLFromGitConfig(configPath, "fork"); err == nil {
+		t.Error("getRemoteURLFromGitConfig() found a url for a remote that isn't configured")
+	}
+}
+
+func TestParseGithubRemoteURL(t *testing.T) {
+	tests := []struct {
+		remoteURL string
+		want      remoteRepository
+		wantErr   bool
+	}{
+		{remoteURL: "ssh://git@github.com/owner/repo.git", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "ssh://git@github.com:22/owner/repo.git", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "git+ssh://git@github.com/owner/repo", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "git://github.com/owner/repo.git", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "https://GitHub.com/owner/repo/", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "https://user@github.com/owner/repo.git", want: remoteRepository{Host: "github.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "https://ghe.example.com/owner/repo.git", want: remoteRepository{Host: "ghe.example.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "https://ghe.example.com:8443/owner/repo.git", want: remoteRepository{Host: "ghe.example.com:8443", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "ssh://git@ghe.example.com:2222/owner/repo.git", want: remoteRepository{Host: "ghe.example.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "git@ghe.example.com:owner/repo.git", want: remoteRepository{Host: "ghe.example.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "ghe.example.com:owner/repo", want: remoteRepository{Host: "ghe.example.com", Owner: "owner", Repo: "repo"}},
+		{remoteURL: "file:///srv/git/owner/repo.git", wantErr: true},
+		{remoteURL: "/srv/git/repo.git", wantErr: true},
+		{remoteURL: "https://github.com/owner", wantErr: true},
+		{remoteURL: "https://github.com/owner/group/repo.git", wantErr: true},
+		{remoteURL: "git@github.com:repo.git", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseGithubRemoteURL(test.remoteURL)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseGithubRemoteURL(%q) = %+v, want an error", test.remoteURL, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGithubRemoteURL(%q) error = %v", test.remoteURL, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseGithubRemoteURL(%q) = %+v, want %+v", test.remoteURL, got, test.want)
+		}
+	}
+}
+
+func TestApplyInsteadOf(t *testing.T) {
+	userConfig := writeGitConfig(t, `[url "git@github.com:"]
+	insteadOf = gh:
+[url "https://ghe.example.com/"]
+	insteadOf = work:
+`)
+	repoConfig := writeGitConfig(t, `[url "git@ghe.example.com:platform/"]
+	insteadOf = work:platform/
+`)
+	missingConfig := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		remoteURL string
+		want      string
+	}{
+		{remoteURL: "gh:owner/repo.git", want: "git@github.com:owner/repo.git"},
+		{remoteURL: "work:owner/repo.git", want: "https://ghe.example.com/owner/repo.git"},
+		// The longest matching prefix wins, whichever file it's in.
+		{remoteURL: "work:platform/repo.git", want: "git@ghe.example.com:platform/repo.git"},
+		{remoteURL: "https://github.com/owner/repo.git", want: "https://github.com/owner/repo.git"},
+	}
+	for _, test := range tests {
+		got, err := applyInsteadOf(test.remoteURL, missingConfig, userConfig, repoConfig)
+		if err != nil {
+			t.Errorf("applyInsteadOf(%q) error = %v", test.remoteURL, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("applyInsteadOf(%q) = %q, want %q", test.remoteURL, got, test.want)
+		}
+		if _, err := parseGithubRemoteURL(got); err != nil {
+			t.Errorf("parseGithubRemoteURL(%q) error = %v", got, err)
+		}
+	}
+}
+
+func TestGetRepoFromGitDirUsesTheRemote(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	gitDir := t.TempDir()
+	config := `[remote "origin"]
+	url = git@github.com:someone/delete-old-branches.git
+[remote "upstream"]
+	url = https://github.com/liam-mackie/delete-old-branches.git
+`
+	if err := os.WriteFile(filepath.Join(gitDir, "config"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for remote, head := range map[string]string{"origin": "develop", "upstream": "main"} {
+		dir := filepath.Join(gitDir, "refs", "remotes", remote)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/remotes/"+remote+"/"+head+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		remote            string
+		wantRepo          remoteRepository
+		wantDefaultBranch string
+	}{
+		{remote: "origin", wantRepo: remoteRepository{Host: "github.com", Owner: "someone", Repo: "delete-old-branches"}, wantDefaultBranch: "develop"},
+		{remote: "upstream", wantRepo: remoteRepository{Host: "github.com", Owner: "liam-mackie", Repo: "delete-old-branches"}, wantDefaultBranch: "main"},
+	}
+	for _, test := range tests {
+		repo, defaultBranch, err := getRepoFromGitDir(gitDir, test.remote)
+		if err != nil {
+			t.Errorf("getRepoFromGitDir(%s) error = %v", test.remote, err)
+			continue
+		}
+		if repo != test.wantRepo || defaultBranch != test.wantDefaultBranch {
+			t.Errorf("getRepoFromGitDir(%s) = %+v, %q, want %+v, %q", test.remote, repo, defaultBranch, test.wantRepo, test.wantDefaultBranch)
+		}
+	}
+
+	if _, _, err := getRepoFromGitDir(gitDir, "fork"); err == nil {
+		t.Error("getRepoFromGitDir(fork) succeeded for a remote that isn't configured")
+	}
+}
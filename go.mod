@@ -5,9 +5,11 @@ go 1.22
 require (
 	github.com/shurcooL/githubv4 v0.0.0-20240429030203-be2daab69064
 	golang.org/x/oauth2 v0.19.0
+	golang.org/x/term v0.20.0
 )
 
 require (
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/shurcooL/graphql v0.0.0-20230722043721-ed46e5a46466 // indirect
+	golang.org/x/sys v0.20.0 // indirect
 )
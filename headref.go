@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// headRefMapper translates local branch names into the head ref names their
+// pull requests were opened from, for teams whose local naming differs from
+// what they push. It's only used for querying, never for git commands.
+type headRefMapper struct {
+	stripPrefix string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newHeadRefMapper builds a mapper from a prefix to strip and an optional
+// branch map in REGEX=REPLACEMENT form.
+func newHeadRefMapper(stripPrefix string, branchMap string) (headRefMapper, error) {
+	mapper := headRefMapper{stripPrefix: stripPrefix}
+	if branchMap == "" {
+		return mapper, nil
+	}
+	expr, replacement, ok := strings.Cut(branchMap, "=")
+	if !ok {
+		return mapper, fmt.Errorf("branch map %q must be in REGEX=REPLACEMENT form", branchMap)
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return mapper, fmt.Errorf("branch map %q: %w", branchMap, err)
+	}
+	mapper.pattern = pattern
+	mapper.replacement = replacement
+	return mapper, nil
+}
+
+func (m headRefMapper) headRef(branch string) string {
+	headRef := strings.TrimPrefix(branch, m.stripPrefix)
+	if m.pattern != nil {
+		headRef = m.pattern.ReplaceAllString(headRef, m.replacement)
+	}
+	return headRef
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runHook runs a user supplied shell command with the given extra environment,
+// killing it if it runs longer than the timeout.
+func runHook(ctx context.Context, command string, timeout time.Duration, env []string) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("timed out after %v", timeout)
+	}
+	return output, err
+}
+
+func hookEnv(branch string, prUrls []string) []string {
+	return []string{
+		"DOB_BRANCH=" + branch,
+		"DOB_PR_URLS=" + strings.Join(prUrls, " "),
+	}
+}
+
+// runPostDeleteHook runs the post-delete hook for a deleted branch. Failures
+// are reported but never affect the rest of the run.
+func runPostDeleteHook(ctx context.Context, command string, timeout time.Duration, verbose bool, branch string, prUrls []string) {
+	output, err := runHook(ctx, command, timeout, hookEnv(branch, prUrls))
+	if verbose && len(output) > 0 {
+		logf("Post-delete hook output for branch %s:\n%s\n", branch, strings.TrimRight(string(output), "\n"))
+	}
+	if err != nil {
+		logf("Post-delete hook failed for branch %s: %v\n", branch, err)
+	}
+}
+
+// runPreDeleteCheck runs the pre-delete check for a branch about to be deleted,
+// returning why the deletion was vetoed or an empty string if it may go ahead.
+// A check that fails to run or times out vetoes the deletion too.
+func runPreDeleteCheck(ctx context.Context, command string, timeout time.Duration, verbose bool, branch string, prUrls []string) string {
+	output, err := runHook(ctx, command, timeout, hookEnv(branch, prUrls))
+	if verbose && len(output) > 0 {
+		logf("Pre-delete check output for branch %s:\n%s\n", branch, strings.TrimRight(string(output), "\n"))
+	}
+	if err == nil {
+		return ""
+	}
+	if firstLine, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); firstLine != "" {
+		return fmt.Sprintf("vetoed by -pre-delete-check: %s", firstLine)
+	}
+	return fmt.Sprintf("vetoed by -pre-delete-check (%v)", err)
+}
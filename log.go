@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// logOutput receives all progress and diagnostic output, so it can be moved to
+// stderr when stdout carries machine readable results.
+var logOutput io.Writer = os.Stdout
+
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(logOutput, format, args...)
+}
@@ -3,10 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/shurcooL/githubv4"
 	"golang.org/x/oauth2"
@@ -15,125 +26,1561 @@ import (
 type pullRequests []pullRequest
 
 type branches []string
+
+// branchCandidate is a branch being evaluated for deletion, either a local
+// branch or, when Remote is set, a branch on that remote.
+type branchCandidate struct {
+	Name   string
+	Remote string
+}
+
+// ref returns the name git commands should use to refer to the branch.
+func (c branchCandidate) ref() string {
+	if c.Remote == "" {
+		return c.Name
+	}
+	return "refs/remotes/" + c.Remote + "/" + c.Name
+}
+
+func (c branchCandidate) String() string {
+	if c.Remote == "" {
+		return c.Name
+	}
+	return c.Remote + "/" + c.Name
+}
+
+// pendingDeletion is a branch that's been chosen for deletion, with what's
+// needed to record it once it's deleted.
+type pendingDeletion struct {
+	branch   string
+	reason   string
+	prs      pullRequests
+	commit   string
+	upstream string
+
+	// steps are the -explain conditions evaluated for a queued branch, printed
+	// once its batch deletion is recorded.
+	steps []string
+}
+
 type pullRequest struct {
-	Number int
-	Merged bool
-	State  githubv4.PullRequestState
+	Number     int
+	Merged     bool
+	MergedAt   *githubv4.DateTime
+	ClosedAt   *githubv4.DateTime
+	UpdatedAt  githubv4.DateTime
+	HeadRefOid githubv4.GitObjectID
+	IsDraft    bool
+	State      githubv4.PullRequestState
+	Title      string
+
+	// Author is nil when the author's account has been deleted.
+	Author *struct {
+		Login string
+	}
+
+	// HeadRepositoryOwner is nil once the repository the pull request was
+	// opened from is deleted.
+	HeadRepositoryOwner *struct {
+		Login string
+	}
+
+	// MergeCommit is nil unless the pull request is merged.
+	MergeCommit *struct {
+		Oid githubv4.GitObjectID
+	}
+
+	// BaseRef is nil once the branch the pull request targeted is deleted,
+	// while BaseRefName still holds its name.
+	BaseRefName string
+	BaseRef     *struct {
+		Name string
+	}
 }
 
-func main() {
+func main() {
+
+	// Get flags
+	safeMode := flag.Bool("safe", false, "Enable safe mode")
+	forceMode := flag.Bool("force", false, "Enable deleting closed branches, not just merged")
+	olderThan := flag.Duration("older-than", 0, "Only delete branches older than this duration (e.g. 720h)")
+	sinceLastRun := flag.Bool("since-last-run", false, "Only evaluate branches that became stale since the last error-free run over every branch that could delete branches")
+	newerThan := flag.Duration("newer-than", 0, "Only consider branches whose last commit is more recent than this duration")
+	ageSource := flag.String("age-source", "commit", "Measure branch age from the last commit (commit) or when its PR merged (merged)")
+	ageFallback := flag.String("age-fallback", "commit", "With -age-source merged, branches without a merged PR use the commit date (commit) or are skipped (skip)")
+	deleteClosedOlderThan := flag.Duration("delete-closed-older-than", 0, "Delete branches whose pull requests were all closed without merging, once the last was closed longer ago than this; a cautious alternative to -force")
+	minAgeMerged := flag.Duration("min-age-merged", 0, "Keep merged branches until their most recent PR merged at least this long ago")
+	configPath := flag.String("config", defaultConfigFile, "Path to the JSON config file containing profiles")
+	profile := flag.String("profile", "", "Apply the named profile from the config file before command line flags")
+	baseCommit := flag.String("base-commit", "", "Check ancestry and merges against this commit instead of the tip of the default branch, for reproducible runs")
+	defaultFrom := flag.String("default-from", "detected", "Where the default branch comes from: detected (gh or git config) or remote (the -remote's HEAD)")
+	assumeDefault := flag.String("assume-default", "", "Treat this local branch as the default branch instead of the detected one")
+	var onlyBranches stringListFlag
+	flag.Var(&onlyBranches, "branch", "Evaluate only this local branch instead of every branch (repeatable)")
+	stdin0 := flag.Bool("stdin0", false, "Evaluate only the NUL separated branch names read from stdin, as printed by git for-each-ref --format='%(refname:short)%00'")
+	var protectPaths stringListFlag
+	flag.Var(&protectPaths, "protect-path", "Keep branches changing files matching this CODEOWNERS style pattern, such as migrations/ or infra/**, unless -force is set; runs a git diff per branch (repeatable)")
+	noMigrationGuard := flag.Bool("no-migration-guard", false, "Don't protect master when main is the default branch, or main when master is, while both exist")
+	var protectBranches stringListFlag
+	flag.Var(&protectBranches, "protect-branch", "Never delete this branch, in addition to the default branch (repeatable)")
+	safeDelete := flag.Bool("safe-delete", false, "Delete with git branch -d so git refuses branches not merged into HEAD")
+	checkReleases := flag.Bool("check-releases", false, "Keep branches targeted by a draft Github release")
+	respectRemoteActivity := flag.Bool("respect-remote-activity", false, "Keep branches whose remote counterpart was updated within -remote-activity-window")
+	remoteActivityWindow := flag.Duration("remote-activity-window", 7*24*time.Hour, "How recently a remote branch must have been updated to be considered active")
+	ignoreForkPrs := flag.Bool("ignore-fork-prs", false, "Ignore pull requests opened from forks that happen to share a branch's name")
+	probeOnly := flag.Bool("probe", false, "Check the token and access to the repository, report what it allows, then exit without touching branches")
+	tokenFile := flag.String("token-from-file", "", "Read the Github token from this file, such as a mounted secret, instead of gh or the environment")
+	noGh := flag.Bool("no-gh", false, "Never use the gh CLI: read the token from GH_TOKEN or GITHUB_TOKEN and detect the repo from git")
+	remote := flag.String("remote", "origin", "Name of the git remote branches are pushed to")
+	queryTimeout := flag.Duration("query-timeout", 30*time.Second, "Give up on a Github query after this long and retry it like a network error (0 waits indefinitely)")
+	networkRetries := flag.Int("network-retries", 3, "Number of times to retry a Github query after a network error")
+	retryDelay := flag.Duration("retry-delay", time.Second, "Base delay before retrying after a network error, doubled for each retry")
+	rateLimitReserve := flag.Int("rate-limit-reserve", 10, "Pause until the Github rate limit resets once this many requests remain")
+	traceHttp := flag.Bool("trace-http", false, "Log every Github API request and response body to stderr, with the token redacted")
+	showStats := flag.Bool("stats", false, "Print Github API request and rate limit statistics at the end of the run")
+	apiPageSize := flag.Int("api-page-size", 100, "Number of pull requests fetched per Github query, from 1 to 100")
+	dedupeByPr := flag.Bool("dedupe-by-pr", false, "Query each head ref once and report branches that share the same pull requests together")
+	prLookback := flag.Duration("pr-lookback", 0, "Ignore pull requests last updated longer ago than this duration (default unlimited)")
+	urlTemplate := flag.String("url-template", defaultPrUrlTemplate, "Template for printed pull request links, using {owner}, {repo} and {number}")
+	forceUnsafe := flag.Bool("force-unsafe", false, "Bypass every safety check: tagged branch tips (-ignore-tagged), commits ahead of upstream (-allow-ahead), commits on no remote (-allow-unpushed), stashes (-ignore-stashes) and remote activity (-respect-remote-activity)")
+	stripPrefix := flag.String("strip-prefix", "", "Strip this prefix from local branch names when looking up their pull requests")
+	branchMap := flag.String("branch-map", "", "Rewrite local branch names as REGEX=REPLACEMENT when looking up their pull requests")
+	unshallow := flag.Bool("unshallow", false, "In a shallow clone, run git fetch --unshallow first so git history checks are accurate")
+	requirePassingChecks := flag.Bool("require-passing-checks", false, "Keep branches whose merged pull requests' last commits didn't pass their status checks (one extra query per merged pull request)")
+	sinceTag := flag.String("since-tag", "", "Only delete branches whose merged pull requests' merge commits are in this tag, such as a release")
+	botAuthorsFlag := flag.String("bot-authors", "dependabot,renovate", "Comma separated bot logins whose closed pull requests don't keep a branch, even without -force")
+	mergeCommitCheck := flag.Bool("merge-commit-check", false, "Keep branches whose merged pull requests' merge commits aren't in the local default branch")
+	mergedPolicy := flag.String("merged-policy", mergedPolicyPr, "How a branch counts as merged: pr (all pull requests merged), git (tip in the default branch), both or either")
+	ignoreStashes := flag.Bool("ignore-stashes", false, "Delete branches even if git stash entries were made on them")
+	allowUnpushed := flag.Bool("allow-unpushed", false, "Delete branches even if they have commits that aren't on any remote branch or the head of one of their pull requests")
+	allowAhead := flag.Bool("allow-ahead", false, "Delete branches even if they have commits not pushed to their upstream")
+	noDefaultSkip := flag.Bool("no-default-skip", false, "DANGEROUS: evaluate the default branch like any other, allowing it to be deleted (requires -yes or confirmation)")
+	yes := flag.Bool("yes", false, "Answer yes to all confirmation prompts")
+	reportOrphans := flag.Bool("report-orphan-remotes", false, "List remote-tracking branches of -remote that no longer exist on it, then exit")
+	pruneOrphans := flag.Bool("prune-orphan-remotes", false, "Remove the remote-tracking branches -report-orphan-remotes lists, then exit")
+	listProtected := flag.Bool("list-protected", false, "List the local branches that protection rules keep, with the reason for each, then exit")
+	teamBranches := flag.Bool("team-branches", false, "Only evaluate branches whose changed files are all owned by -as in CODEOWNERS (runs a git diff per branch)")
+	codeowner := flag.String("as", "", "Login or @org/team to match against CODEOWNERS with -team-branches")
+	localOnly := flag.Bool("local-only", false, "Only delete local branches that were never pushed: no upstream and no branch of the same name on -remote; combine with -older-than to keep recent ones")
+	batchDelete := flag.Bool("batch-delete", false, "Delete local branches with a single git branch command at the end of the run instead of one per branch")
+	pruneEmpty := flag.Bool("prune-empty", false, "Only delete branches with no commits that aren't in the default branch, without looking up pull requests")
+	deleteOrder := flag.String("delete-order", "name", "Order to evaluate and delete branches in: name, or topo to delete stacked branches before the branches they were built on (best effort)")
+	reverse := flag.Bool("reverse", false, "Evaluate branches in reverse name order, local branches last")
+	promptDefaultFlag := flag.String("prompt-default", "no", "Answer given to confirmation prompts when Enter is pressed without typing anything: yes or no")
+	promptTimeoutFlag := flag.Duration("prompt-timeout", 0, "Treat a confirmation prompt as declined after waiting this long (default wait indefinitely)")
+	includeRemoteBranches := flag.Bool("include-remote-branches", false, "Also evaluate branches on -remote, deleting them with git push --delete")
+	match := flag.String("match", "", "Comma separated branch globs to select, with ! to exclude; the last matching pattern wins (e.g. 'feature/*,!feature/keep-*')")
+	filterPrState := flag.String("filter-pr-state", "", "Only report branches with pull requests in these comma separated states: OPEN, CLOSED, MERGED, NONE")
+	ignoreTagged := flag.Bool("ignore-tagged", false, "Delete branches even if a tag points at their tip")
+	showDiffstat := flag.Bool("show-diffstat", false, "Show a diff stat of what each deletable branch contributed relative to the default branch")
+	openPrsOnly := flag.Bool("output-open-prs-only", false, "At the end of the run, list the open pull requests keeping branches, sorted by number, and add them to -output JSON")
+	summaryOnly := flag.Bool("summary-only", false, "Print nothing but the final counts of deleted, kept and errored branches to stdout")
+	stream := flag.Bool("stream", false, "Write each result to stdout as a JSON line as soon as it is decided, without keeping results in memory; other output goes to stderr")
+	templateFile := flag.String("template-file", "", "Render the results to stdout with this Go text/template file, sending all other output to stderr; see Template fields below")
+	csvOutput := flag.Bool("csv", false, "Write results as CSV to stdout, sending all other output to stderr")
+	outputPath := flag.String("output", "", "Write the results of the run as JSON to this file")
+	outputFormat := flag.String("output-format", "json", "Format of the -output file: json or text")
+	comparePath := flag.String("compare", "", "Compare results against a previous -output JSON file, marking branches as new, still-kept or newly-deletable")
+	notifyWebhook := flag.String("notify-webhook", "", "POST a JSON summary of the run to this URL, such as a Slack incoming webhook")
+	notifyOn := flag.String("notify-on", notifyAlways, "When to call -notify-webhook: always, on-delete or on-error")
+	metricsPath := flag.String("metrics", "", "Write Prometheus metrics for the run to this file, for the node_exporter textfile collector")
+	prExportPath := flag.String("pr-export", "", "Write the pull requests fetched for each branch to this JSON file, for -pr-import")
+	prImportPath := flag.String("pr-import", "", "Read pull requests from a -pr-export file instead of querying Github for them")
+	prImportMaxAge := flag.Duration("pr-import-max-age", 24*time.Hour, "Refuse a -pr-import file exported longer ago than this (0 accepts any age)")
+	summaryFile := flag.String("summary-file", "", "Write a Markdown summary of the run to this file")
+	recreateTracking := flag.Bool("recreate-tracking", false, "Record the commit and upstream of each deleted local branch, and print how to restore it")
+	preDeleteCheck := flag.String("pre-delete-check", "", "Shell command run before each deletion, with DOB_BRANCH and DOB_PR_URLS set; a non-zero exit keeps the branch")
+	postDeleteHook := flag.String("post-delete-hook", "", "Shell command run after each deleted branch, with DOB_BRANCH and DOB_PR_URLS set")
+	hookTimeout := flag.Duration("hook-timeout", 30*time.Second, "Maximum time a hook command may run")
+	failFast := flag.Bool("fail-fast", false, "Stop at the first branch that fails to be checked or deleted (by default failures are reported and the run continues)")
+	ignoreErrorBranches := flag.Bool("ignore-error-branches", false, "Exit successfully even if some branches failed to be checked or deleted (by default any failure exits with status 1)")
+	dryRunExitCode := flag.Int("dry-run-exit-code", 0, "With -safe, exit with this status if any branch would have been deleted, such as from a git hook")
+	assertClean := flag.Bool("assert-clean", false, "Report only, exiting with status 1 if any branch could be deleted, for use in CI")
+	explain := flag.Bool("explain", false, "Print every condition evaluated for each branch and the resulting decision")
+	verbose := flag.Bool("verbose", false, "Print additional detail, such as hook output")
+	runID := flag.String("run-id", "", "Identify this run in every JSON output, event, webhook and summary, to correlate them in aggregated logs (default a random UUID)")
+	eventsPath := flag.String("events", "", "Append a JSON line per branch decision to this file as it happens")
+	flag.Usage = usage
+	flag.Parse()
+
+	// Registered first so it runs after every other deferred function, once the
+	// outputs for a run that failed during setup have been written.
+	setupFailed := true
+	defer func() {
+		if setupFailed {
+			os.Exit(1)
+		}
+	}()
+
+	// The profile can set output flags, so it's applied before they pick where
+	// console output goes.
+	if err := applyProfile(*configPath, *profile); err != nil {
+		logf("Failed to apply profile: %v\n", err)
+		return
+	}
+
+	if *csvOutput || *stream || *templateFile != "" {
+		logOutput = os.Stderr
+	}
+	if *summaryOnly {
+		logOutput = io.Discard
+	}
+
+	if *ageSource != "commit" && *ageSource != "merged" {
+		logf("Invalid -age-source %q, must be one of: commit, merged\n", *ageSource)
+		return
+	}
+	if *ageFallback != "commit" && *ageFallback != "skip" {
+		logf("Invalid -age-fallback %q, must be one of: commit, skip\n", *ageFallback)
+		return
+	}
+
+	if !slices.Contains(mergedPolicies, *mergedPolicy) {
+		logf("Invalid -merged-policy %q, must be one of: %s\n", *mergedPolicy, strings.Join(mergedPolicies, ", "))
+		return
+	}
+
+	if *stream {
+		// These outputs are built from every result, so they need results kept in memory.
+		for _, buffered := range []struct {
+			name string
+			set  bool
+		}{
+			{"output", *outputPath != ""},
+			{"csv", *csvOutput},
+			{"template-file", *templateFile != ""},
+			{"compare", *comparePath != ""},
+			{"summary-file", *summaryFile != ""},
+			{"output-open-prs-only", *openPrsOnly},
+			{"notify-webhook", *notifyWebhook != ""},
+		} {
+			if buffered.set {
+				logf("-stream can't be combined with -%s, which needs every result kept until the end of the run\n", buffered.name)
+				return
+			}
+		}
+	}
+
+	var reportTemplate *template.Template
+	if *templateFile != "" {
+		if *csvOutput {
+			logf("-template-file can't be combined with -csv, which also writes to stdout\n")
+			return
+		}
+		var err error
+		reportTemplate, err = loadReportTemplate(*templateFile)
+		if err != nil {
+			logf("Failed to load -template-file: %v\n", err)
+			return
+		}
+	}
+
+	if *stdin0 {
+		names, err := readNulSeparated(os.Stdin)
+		if err != nil {
+			logf("Failed to read branch names from stdin: %v\n", err)
+			return
+		}
+		if len(names) == 0 {
+			logf("No branch names read from stdin\n")
+			return
+		}
+		onlyBranches = append(onlyBranches, names...)
+	}
+
+	if *listProtected && len(onlyBranches) > 0 {
+		logf("-list-protected lists every local branch, so it can't be combined with -branch or -stdin0\n")
+		return
+	}
+
+	if *prImportPath != "" && *prExportPath != "" {
+		logf("-pr-import and -pr-export can't be combined\n")
+		return
+	}
+
+	if *failFast && *ignoreErrorBranches {
+		logf("-fail-fast and -ignore-error-branches can't be combined\n")
+		return
+	}
+
+	if *localOnly && *pruneEmpty {
+		logf("-local-only and -prune-empty can't be combined\n")
+		return
+	}
+	if *localOnly && *includeRemoteBranches {
+		logf("-local-only only evaluates local branches, so it can't be combined with -include-remote-branches\n")
+		return
+	}
+
+	if *deleteOrder != "name" && *deleteOrder != "topo" {
+		logf("Invalid -delete-order %q, must be one of: name, topo\n", *deleteOrder)
+		return
+	}
+
+	if *defaultFrom != "detected" && *defaultFrom != "remote" {
+		logf("Invalid -default-from %q, must be one of: detected, remote\n", *defaultFrom)
+		return
+	}
+
+	if !slices.Contains(notifyOnValues, *notifyOn) {
+		logf("Invalid -notify-on %q, must be one of: %s\n", *notifyOn, strings.Join(notifyOnValues, ", "))
+		return
+	}
+
+	if *outputFormat != "json" && *outputFormat != "text" {
+		logf("Invalid -output-format %q, must be one of: json, text\n", *outputFormat)
+		return
+	}
+
+	if !strings.Contains(*urlTemplate, "{number}") {
+		logf("Invalid -url-template %q, it must contain {number}\n", *urlTemplate)
+		return
+	}
+
+	if *olderThan > 0 && *newerThan > 0 && *newerThan <= *olderThan {
+		logf("-newer-than (%v) must be greater than -older-than (%v), otherwise no branch can match\n", *newerThan, *olderThan)
+		return
+	}
+
+	if *assertClean {
+		*safeMode = true
+	}
+	// Arguments after -- are passed to git push when deleting remote branches.
+	extraGitArgs := flag.Args()
+	if err := checkExtraDeleteArgs(extraGitArgs); err != nil {
+		logf("Invalid extra git arguments: %v\n", err)
+		return
+	}
+	if len(extraGitArgs) > 0 && !*includeRemoteBranches {
+		logf("Warning: options after -- are only passed to git push, which needs -include-remote-branches\n")
+	}
+	if *apiPageSize < 1 || *apiPageSize > 100 {
+		logf("Invalid -api-page-size %d, it must be between 1 and 100\n", *apiPageSize)
+		return
+	}
+	if *promptTimeoutFlag < 0 {
+		logf("Invalid -prompt-timeout %v, it must not be negative\n", *promptTimeoutFlag)
+		return
+	}
+	promptTimeout = *promptTimeoutFlag
+	if *promptDefaultFlag != "yes" && *promptDefaultFlag != "no" {
+		logf("Invalid -prompt-default %q, must be one of: yes, no\n", *promptDefaultFlag)
+		return
+	}
+	promptDefault = *promptDefaultFlag == "yes"
+	if *dryRunExitCode < 0 || *dryRunExitCode > 125 {
+		logf("Invalid -dry-run-exit-code %d, it must be between 0 and 125\n", *dryRunExitCode)
+		return
+	}
+
+	if *runID == "" {
+		id, err := newRunID()
+		if err != nil {
+			logf("Failed to generate a run ID: %v\n", err)
+			return
+		}
+		*runID = id
+	}
+	if *verbose {
+		logf("Run ID: %s\n", *runID)
+	}
+
+	events, err := openEventLog(*eventsPath, *runID)
+	if err != nil {
+		logf("Failed to open events file: %v\n", err)
+		return
+	}
+	defer events.Close()
+
+	startedAt := time.Now()
+	var lastRun time.Time
+	if *sinceLastRun {
+		lastRun, err = readLastRun()
+		if err != nil {
+			logf("Failed to read the time of the last run: %v\n", err)
+			return
+		}
+		if lastRun.IsZero() {
+			logf("No previous run recorded, evaluating all branches\n")
+		}
+	}
+
+	results := &runResults{runID: *runID, events: events, includeOpenPRs: *openPrsOnly}
+	if *stream {
+		results.stream = json.NewEncoder(os.Stdout)
+	}
+	var previous *resultsFile
+	if *comparePath != "" {
+		previous, err = loadResultsFile(*comparePath)
+		if err != nil {
+			logf("Failed to load previous results: %v\n", err)
+			return
+		}
+	}
+
+	stats := &apiStats{}
+	var exported *prExport
+	finished := false
+	defer func() {
+		if *summaryOnly {
+			fmt.Println(results.totals())
+			if !finished {
+				fmt.Fprintln(os.Stderr, "The run did not finish, rerun without -summary-only to see why")
+			}
+		}
+		if previous != nil {
+			counts := results.compare(previous)
+			logf("Compared with %s: %d new, %d newly deletable, %d still deletable, %d still kept\n",
+				*comparePath, counts[comparisonNew], counts[comparisonNewlyDeletable], counts[comparisonStillDeletable], counts[comparisonStillKept])
+		}
+		if *openPrsOnly {
+			printOpenPullRequests(results.openPullRequests())
+		}
+		if *csvOutput {
+			if err := results.CSV(os.Stdout); err != nil {
+				logf("Failed to write CSV: %v\n", err)
+			}
+		}
+		if reportTemplate != nil {
+			if err := results.Template(os.Stdout, reportTemplate); err != nil {
+				logf("Failed to render -template-file: %v\n", err)
+			}
+		}
+		if *outputPath != "" {
+			render := results.JSON
+			if *outputFormat == "text" {
+				render = results.Text
+			}
+			if err := writeResultsFile(*outputPath, render); err != nil {
+				logf("Failed to write output file: %v\n", err)
+			}
+		}
+		if *summaryFile != "" {
+			if err := writeResultsFile(*summaryFile, results.Markdown); err != nil {
+				logf("Failed to write summary file: %v\n", err)
+			}
+		}
+		if exported != nil {
+			if err := writeFileAtomically(*prExportPath, exported.JSON); err != nil {
+				logf("Failed to write -pr-export file: %v\n", err)
+			}
+		}
+		if *metricsPath != "" {
+			render := func(w io.Writer) error {
+				return results.Metrics(w, stats.requestCount(), time.Since(startedAt))
+			}
+			if err := writeFileAtomically(*metricsPath, render); err != nil {
+				logf("Failed to write metrics file: %v\n", err)
+			}
+		}
+		if *notifyWebhook != "" && results.shouldNotify(*notifyOn) {
+			if err := postWebhook(*notifyWebhook, results.webhookSummary()); err != nil {
+				logf("Failed to notify webhook: %v\n", err)
+			}
+		}
+		// Only a run that evaluated every branch without errors is recorded, since
+		// -since-last-run skips branches that haven't changed since then.
+		filtered := len(onlyBranches) > 0 || *match != "" || *pruneEmpty || *localOnly || *teamBranches || *filterPrState != "" || *newerThan > 0
+		if finished && !*safeMode && !filtered && results.count(actionError) == 0 {
+			if err := writeLastRun(startedAt); err != nil {
+				logf("Failed to record the time of this run: %v\n", err)
+			}
+		}
+		if *assertClean && !finished {
+			logf("-assert-clean: the run did not finish, so the repository can't be confirmed clean\n")
+			events.Close()
+			os.Exit(1)
+		}
+		if *assertClean {
+			if failed := results.count(actionWouldDelete, actionError); failed > 0 {
+				logf("-assert-clean: %d branches could be deleted or failed to be checked\n", failed)
+				events.Close()
+				os.Exit(1)
+			}
+			logf("-assert-clean: no branches left to delete\n")
+		}
+		if failed := results.count(actionError); failed > 0 && !*ignoreErrorBranches {
+			logf("%d branches failed, exiting with an error (use -ignore-error-branches to ignore failures)\n", failed)
+			events.Close()
+			os.Exit(1)
+		}
+		if *safeMode && *dryRunExitCode != 0 && results.count(actionWouldDelete) > 0 {
+			events.Close()
+			os.Exit(*dryRunExitCode)
+		}
+	}()
+
+	// Create context, cancelled on interrupt so in-flight commands are terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// -prune-empty, -local-only and the orphan remote report only need git, so
+	// they run without a token or gh, even when the remote isn't on Github.
+	gitOnly := *pruneEmpty || *localOnly || *reportOrphans || *pruneOrphans
+
+	// Get token from GH CLI
+	var token string
+	if !gitOnly {
+		err, token = getToken(*tokenFile, !*noGh)
+	}
+	if err != nil && *prImportPath != "" {
+		logf("Warning: no Github token, only pull requests from -pr-import can be used: %v\n", err)
+	} else if err != nil {
+		logf("Failed to get Github token: %v\n", err)
+		return
+	}
+
+	newHttpClient := func(token string) *http.Client {
+		clientCtx := ctx
+		if *traceHttp {
+			// The oauth2 transport wraps the client in the context, so requests are
+			// traced after the token is added to them and the trace redacts it.
+			tracingClient := &http.Client{Transport: &traceTransport{base: http.DefaultTransport, token: token}}
+			clientCtx = context.WithValue(ctx, oauth2.HTTPClient, tracingClient)
+		}
+		httpClient := getHttpClient(token, clientCtx)
+		httpClient.Transport = &rateLimitTransport{base: httpClient.Transport, stats: stats, reserve: *rateLimitReserve}
+		return httpClient
+	}
+	httpClient := newHttpClient(token)
+	if *showStats {
+		defer func() {
+			logf("%s\n", stats)
+		}()
+	}
+
+	var remoteRepo remoteRepository
+	var defaultBranch string
+	if gitOnly {
+		remoteRepo, defaultBranch, err = getRepoFromGitConfig(*remote)
+		if err != nil {
+			if defaultBranch, err = getRemoteHead(ctx, *remote); err != nil {
+				logf("Failed to read %s/HEAD, try git remote set-head %s --auto: %v\n", *remote, *remote, err)
+				return
+			}
+		}
+	} else if *noGh {
+		remoteRepo, defaultBranch, err = getRepoFromGitConfig(*remote)
+	} else {
+		remoteRepo, defaultBranch, err = getCurrentGithubRepo(ctx)
+		if err != nil {
+			logf("Failed to get current Github repo from gh, falling back to .git/config: %v\n", err)
+			remoteRepo, defaultBranch, err = getRepoFromGitConfig(*remote)
+		}
+	}
+	if err != nil {
+		logf("Failed to get current Github repo: %v\n", err)
+		return
+	}
+	owner, repo := remoteRepo.Owner, remoteRepo.Repo
+
+	graphqlURL, restURL := githubAPIURLs(remoteRepo.Host)
+	client := &retryingClient{client: getGraphqlClient(httpClient, graphqlURL), retries: *networkRetries, baseDelay: *retryDelay, queryTimeout: *queryTimeout, verbose: *verbose, stats: stats, reserve: *rateLimitReserve}
+	if *tokenFile == "" && !*noGh {
+		client.refresh = func() (*githubv4.Client, error) {
+			refreshed, err := getGhToken()
+			if err != nil {
+				return nil, err
+			}
+			if refreshed == token {
+				return nil, errors.New("gh returned the same token")
+			}
+			token = refreshed
+			httpClient = newHttpClient(token)
+			return getGraphqlClient(httpClient, graphqlURL), nil
+		}
+	}
+	if *urlTemplate == defaultPrUrlTemplate && remoteRepo.Host != "github.com" {
+		*urlTemplate = "https://" + remoteRepo.Host + "/{owner}/{repo}/pull/{number}"
+	}
+
+	if *probeOnly {
+		if err := probe(ctx, client, owner, repo); err != nil {
+			logf("Probe failed: %v\n", err)
+			return
+		}
+		setupFailed = false
+		return
+	}
+
+	var imported *prExport
+	if *prImportPath != "" {
+		imported, err = loadPrExport(*prImportPath, owner, repo, *prImportMaxAge)
+		if err != nil {
+			logf("Failed to load -pr-import file: %v\n", err)
+			return
+		}
+		logf("Using pull requests exported at %s from %s\n", imported.GeneratedAt.Local().Format(time.DateTime), *prImportPath)
+	}
+	if *prExportPath != "" {
+		exported = newPrExport(owner, repo)
+	}
+
+	if *reportOrphans || *pruneOrphans {
+		if err := reportOrphanRemotes(ctx, *remote, *pruneOrphans, *safeMode); err != nil {
+			logf("Failed to check remote-tracking branches: %v\n", err)
+			return
+		}
+		setupFailed = false
+		return
+	}
+
+	shallow, err := isShallowRepository(ctx)
+	if err != nil {
+		logf("Failed to check for a shallow clone: %v\n", err)
+		return
+	}
+	if shallow && *unshallow {
+		logf("Repository is a shallow clone, fetching full history from %s...\n", *remote)
+		if err := unshallowRepository(ctx, *remote); err != nil {
+			logf("Failed to unshallow repository: %v\n", err)
+			return
+		}
+	} else if shallow {
+		logf("Warning: repository is a shallow clone, so commit dates, diff stats and git merge checks may be inaccurate (use -unshallow to fetch full history)\n")
+	}
+
+	if *defaultFrom == "remote" {
+		remoteDefault, err := getRemoteHead(ctx, *remote)
+		if err != nil {
+			logf("Failed to read %s/HEAD, try git remote set-head %s --auto: %v\n", *remote, *remote, err)
+			return
+		}
+		if remoteDefault != defaultBranch {
+			logf("Warning: %s/HEAD points at %s but the detected default branch is %s, using %s\n", *remote, remoteDefault, defaultBranch, remoteDefault)
+		}
+		defaultBranch = remoteDefault
+	}
+
+	if *assumeDefault != "" {
+		exists, err := branchExists(ctx, *assumeDefault)
+		if err != nil {
+			logf("Failed to check branch %s: %v\n", *assumeDefault, err)
+			return
+		}
+		if !exists {
+			logf("Branch %s given by -assume-default does not exist locally\n", *assumeDefault)
+			return
+		}
+		if *assumeDefault != defaultBranch {
+			logf("Using %s as the default branch instead of detected %s\n", *assumeDefault, defaultBranch)
+		}
+		defaultBranch = *assumeDefault
+	}
+
+	matcher, err := parseBranchMatcher(*match)
+	if err != nil {
+		logf("Invalid -match: %v\n", err)
+		return
+	}
+
+	prStateFilter, err := parsePrStateFilter(*filterPrState)
+	if err != nil {
+		logf("Invalid -filter-pr-state: %v\n", err)
+		return
+	}
+
+	mapper, err := newHeadRefMapper(*stripPrefix, *branchMap)
+	if err != nil {
+		logf("Invalid -branch-map: %v\n", err)
+		return
+	}
+
+	linker := prLinker{template: *urlTemplate, owner: owner, repo: repo}
+	results.linker = linker
+
+	// Sanitise the branches
+	skipBranch := defaultBranch
+	if *noDefaultSkip {
+		logf("!!! WARNING: -no-default-skip is set, the default branch %s is NOT protected and may be deleted !!!\n", defaultBranch)
+		if !*yes && !confirm(fmt.Sprintf("Really evaluate the default branch %s for deletion?", defaultBranch)) {
+			logf("Aborting, the default branch was not confirmed for evaluation\n")
+			return
+		}
+		skipBranch = ""
+	}
+
+	protectBranches, err = migrationGuard(ctx, defaultBranch, *remote, protectBranches, *noMigrationGuard)
+	if err != nil {
+		logf("Failed to check for a master and main migration: %v\n", err)
+		return
+	}
+
+	var sanitisedBranches branches
+	if len(onlyBranches) > 0 {
+		sanitisedBranches, err = selectNamedBranches(ctx, onlyBranches, skipBranch, protectBranches)
+		if err != nil {
+			logf("Failed to check branches: %v\n", err)
+			return
+		}
+	} else {
+		detached, err := isDetachedHead(ctx)
+		if err != nil {
+			logf("Failed to check for a detached HEAD: %v\n", err)
+			return
+		}
+		if detached {
+			logf("Note: HEAD is detached, so no branch is protected as the current branch\n")
+		}
+
+		// Getting local git branches
+		branchList, err := getBranches(ctx)
+		if err != nil {
+			logf("Failed to get branches: %v\n", err)
+			return
+		}
+		if *listProtected {
+			checkTags := !*ignoreTagged && !*forceUnsafe
+			if err := listProtectedBranches(ctx, branchList, skipBranch, protectBranches, matcher, checkTags); err != nil {
+				logf("Failed to list protected branches: %v\n", err)
+				return
+			}
+			setupFailed = false
+			return
+		}
+		sanitisedBranches = branchList.sanitiseBranches(skipBranch, protectBranches, matcher)
+	}
+
+	var archived bool
+	if !gitOnly && imported == nil {
+		archived, err = isRepositoryArchived(ctx, client, owner, repo)
+		if err != nil {
+			logf("Failed to check whether %s/%s is archived: %v\n", owner, repo, err)
+			return
+		}
+	}
+	if archived {
+		logf("Note: %s/%s is archived, so pull request states are frozen and remote branches can't be deleted\n", owner, repo)
+	}
+
+	var candidates []branchCandidate
+	for _, branch := range sanitisedBranches {
+		candidates = append(candidates, branchCandidate{Name: branch})
+	}
+	if *includeRemoteBranches && len(onlyBranches) > 0 {
+		logf("Skipping remote branches, only the branches named with -branch or -stdin0 are evaluated\n")
+	} else if *includeRemoteBranches && archived {
+		logf("Skipping remote branches, deleting them from an archived repository would fail\n")
+	} else if *includeRemoteBranches {
+		remoteBranches, err := getRemoteBranches(ctx, *remote)
+		if err != nil {
+			logf("Failed to get remote branches: %v\n", err)
+			return
+		}
+		for _, branch := range remoteBranches.sanitiseBranches(skipBranch, protectBranches, matcher) {
+			candidates = append(candidates, branchCandidate{Name: branch, Remote: *remote})
+		}
+	}
+
+	prefixes := []string{"refs/heads/"}
+	if *includeRemoteBranches {
+		prefixes = append(prefixes, "refs/remotes/"+*remote+"/")
+	}
+	results.infos, err = getBranchInfo(ctx, prefixes...)
+	if err != nil {
+		logf("Failed to get branch details: %v\n", err)
+		return
+	}
+	base := defaultBranch
+	if exists, err := branchExists(ctx, defaultBranch); err == nil && !exists {
+		base = "refs/remotes/" + *remote + "/" + defaultBranch
+	}
+	if *baseCommit != "" {
+		// Pinning the base keeps results reproducible while new merges land.
+		base, err = getCommit(ctx, *baseCommit)
+		if err != nil {
+			logf("Failed to resolve -base-commit %s: %v\n", *baseCommit, err)
+			return
+		}
+		logf("Checking ancestry against %.12s instead of the tip of %s\n", base, defaultBranch)
+	}
+	// Counting commits costs a git command per branch, so it's only done when
+	// an output includes the counts.
+	countCommits := *outputPath != "" || *csvOutput || *templateFile != "" || *summaryFile != "" || *stream
+	if countCommits {
+		for _, candidate := range candidates {
+			info := results.infos[candidate.String()]
+			info.Ahead, info.Behind, err = countAheadBehind(ctx, base, candidate.ref())
+			if err != nil {
+				logf("Warning: can't count commits ahead of and behind %s, leaving them out of the results: %v\n", defaultBranch, err)
+				break
+			}
+			results.infos[candidate.String()] = info
+		}
+	}
+
+	// Branches are evaluated in git's name order, local before remote, so runs
+	// are reproducible in either direction.
+	if *reverse {
+		slices.Reverse(candidates)
+	}
+	if *deleteOrder == "topo" {
+		if err := sortTopologically(ctx, candidates); err != nil {
+			logf("Warning: can't order branches by ancestry, evaluating them in name order: %v\n", err)
+		}
+	}
+
+	// -prune-empty and -local-only delete without looking at pull requests, so
+	// they run only the checks that need nothing but the local repository.
+	// Unpushed commits are exactly what -local-only looks for.
+	var safetyChecks, localSafetyChecks []safetyCheck
+	if *forceUnsafe {
+		logf("Safety checks disabled by -force-unsafe\n")
+	} else {
+		if !*ignoreTagged {
+			safetyChecks = append(safetyChecks, taggedSafetyCheck())
+			localSafetyChecks = append(localSafetyChecks, taggedSafetyCheck())
+		}
+		if !*allowAhead {
+			safetyChecks = append(safetyChecks, aheadOfUpstreamSafetyCheck())
+		}
+		if !*allowUnpushed {
+			safetyChecks = append(safetyChecks, unpushedSafetyCheck())
+		}
+		if !*ignoreStashes {
+			stashes, err := getStashes(ctx)
+			if err != nil {
+				logf("Failed to list stashes: %v\n", err)
+				return
+			}
+			safetyChecks = append(safetyChecks, stashSafetyCheck(stashes))
+			localSafetyChecks = append(localSafetyChecks, stashSafetyCheck(stashes))
+		}
+		if *respectRemoteActivity {
+			safetyChecks = append(safetyChecks, remoteActivitySafetyCheck(*remote, *remoteActivityWindow))
+		}
+	}
+
+	var draftReleaseTargets map[string]string
+	if *checkReleases && !gitOnly {
+		draftReleaseTargets, err = getDraftReleaseTargets(ctx, httpClient, restURL, owner, repo)
+		if err != nil {
+			logf("Failed to get draft releases: %v\n", err)
+			return
+		}
+	}
+
+	bots := parseBotAuthors(*botAuthorsFlag)
+
+	var protectedPathPatterns []*regexp.Regexp
+	for _, protectPath := range protectPaths {
+		pattern, err := codeownersPattern(protectPath)
+		if err != nil {
+			logf("Invalid -protect-path %q: %v\n", protectPath, err)
+			return
+		}
+		protectedPathPatterns = append(protectedPathPatterns, pattern)
+	}
+
+	var tagRef string
+	if *sinceTag != "" {
+		tagRef = "refs/tags/" + *sinceTag
+		if _, err := getCommit(ctx, tagRef); err != nil {
+			logf("Tag %s given with -since-tag doesn't exist: %v\n", *sinceTag, err)
+			return
+		}
+	}
+
+	var rules codeowners
+	if *teamBranches {
+		if *codeowner == "" {
+			logf("-team-branches requires -as with a login or @org/team\n")
+			return
+		}
+		root, err := getRepositoryRoot(ctx)
+		if err != nil {
+			logf("Failed to find the repository root: %v\n", err)
+			return
+		}
+		rules, err = loadCodeowners(root)
+		if err != nil {
+			logf("Failed to load CODEOWNERS: %v\n", err)
+			return
+		}
+	}
+
+	var groups *prGroups
+	if *dedupeByPr {
+		groups = newPrGroups()
+		defer groups.report()
+	}
+
+	var currentBranch string
+	if *explain || *pruneEmpty || *localOnly {
+		if *explain {
+			results.trace = &decisionTrace{}
+		}
+		currentBranch, err = getCurrentBranch(ctx)
+		if err != nil {
+			logf("Failed to get the current branch: %v\n", err)
+			return
+		}
+	}
+	trace := results.trace
+
+	// recordDeletion records the outcome of deleting a branch, then prints how
+	// to restore it and runs the post-delete hook.
+	recordDeletion := func(deletion pendingDeletion, err error) {
+		branch := deletion.branch
+		if err != nil {
+			results.record(branch, actionError, fmt.Sprintf("deleting branch: %v", err), deletion.prs)
+		} else if *safeMode {
+			results.recordTracked(branch, actionWouldDelete, deletion.reason, deletion.prs, deletion.commit, deletion.upstream)
+		} else {
+			results.recordTracked(branch, actionDeleted, deletion.reason, deletion.prs, deletion.commit, deletion.upstream)
+			if deletion.commit != "" {
+				printRestoreCommand(branch, deletion.commit, deletion.upstream)
+			}
+			if *postDeleteHook != "" {
+				runPostDeleteHook(ctx, *postDeleteHook, *hookTimeout, *verbose, branch, deletion.prs.getPrUrls(linker))
+			}
+		}
+	}
+
+	// With -batch-delete, local branches are queued and deleted together once
+	// every branch has been evaluated, including when the run stops early.
+	var batch []pendingDeletion
+	defer func() {
+		if len(batch) == 0 {
+			return
+		}
+		names := make([]string, 0, len(batch))
+		for _, deletion := range batch {
+			names = append(names, deletion.branch)
+		}
+		failed := deleteBranches(ctx, names, *safeDelete)
+		for _, deletion := range batch {
+			trace.restore(deletion.steps)
+			recordDeletion(deletion, failed[deletion.branch])
+		}
+	}()
+
+	deleteCandidate := func(candidate branchCandidate, deletion pendingDeletion) {
+		switch {
+		case candidate.Remote != "":
+			recordDeletion(deletion, deleteRemoteBranch(ctx, candidate.Remote, candidate.Name, *safeMode, extraGitArgs))
+		case *batchDelete && !*safeMode:
+			logf("Queueing branch %s to be deleted\n", deletion.branch)
+			deletion.steps = trace.take()
+			batch = append(batch, deletion)
+		default:
+			recordDeletion(deletion, deleteBranch(ctx, deletion.branch, *safeMode, *safeDelete))
+		}
+	}
+
+	var upstreams map[string]upstreamState
+	var remoteHeads map[string]bool
+	if *localOnly {
+		upstreams, err = getUpstreamStates(ctx)
+		if err != nil {
+			logf("Failed to get upstream branches: %v\n", err)
+			return
+		}
+		remoteHeads, err = getRemoteHeads(ctx, *remote)
+		if err != nil {
+			logf("Failed to list branches on %s: %v\n", *remote, err)
+			return
+		}
+	}
+
+	// Pull requests from forks are still fetched, so -pr-export records them
+	// all, but they don't stop the lookup paging early.
+	var headOwner string
+	if *ignoreForkPrs {
+		headOwner = owner
+	}
+
+	setupFailed = false
+	// A branch that fails to be checked or deleted is recorded as an error and the
+	// run moves on to the next, unless -fail-fast is set.
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			logf("Interrupted, stopping before branch %s\n", candidate)
+			return
+		}
+		if *failFast && results.count(actionError) > 0 {
+			logf("Stopping after the first failed branch because of -fail-fast\n")
+			return
+		}
+		branch := candidate.String()
+		ref := candidate.ref()
+		if candidate.Remote == "" {
+			trace.check("default branch", candidate.Name == defaultBranch)
+			trace.check("current branch", candidate.Name == currentBranch)
+		}
+
+		if (*pruneEmpty || *localOnly) && candidate.Remote == "" && candidate.Name == currentBranch {
+			logf("Branch %s is checked out, skipping\n", branch)
+			results.record(branch, actionKept, "checked out", nil)
+			continue
+		}
+
+		if *pruneEmpty {
+			ahead, _, err := countAheadBehind(ctx, base, ref)
+			if err != nil {
+				logf("Error counting commits of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("counting commits: %v", err), nil)
+				continue
+			}
+			trace.check(fmt.Sprintf("no commits ahead of %s", defaultBranch), ahead == 0)
+			if ahead > 0 {
+				if *verbose {
+					logf("Branch %s has %d commits not in %s, skipping\n", branch, ahead, defaultBranch)
+				}
+				results.record(branch, actionKept, fmt.Sprintf("%d commits not in %s", ahead, defaultBranch), nil)
+				continue
+			}
+			reason, err := runSafetyChecks(ctx, localSafetyChecks, candidate, nil)
+			if err != nil {
+				logf("Error running safety checks for branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("running safety checks: %v", err), nil)
+				continue
+			}
+			trace.check("safety checks passed", reason == "")
+			if reason != "" {
+				logf("Branch %s is %s, skipping (use -force-unsafe to bypass safety checks)\n", branch, reason)
+				results.record(branch, actionKept, reason, nil)
+				continue
+			}
+			logf("Branch %s has 0 commits not in %s, deleting\n", branch, defaultBranch)
+			deleteCandidate(candidate, pendingDeletion{branch: branch, reason: fmt.Sprintf("0 commits not in %s", defaultBranch)})
+			continue
+		}
+
+		if *newerThan > 0 {
+			lastCommit, err := getLastCommitTime(ctx, ref)
+			if err != nil {
+				logf("Error getting last commit of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("getting last commit: %v", err), nil)
+				continue
+			}
+			age := time.Since(lastCommit)
+			trace.check(fmt.Sprintf("last commit older than -newer-than %v", *newerThan), age >= *newerThan)
+			if age >= *newerThan {
+				logf("Branch %s was last committed to %v ago, older than %v, skipping\n", branch, age.Round(time.Minute), *newerThan)
+				results.record(branch, actionKept, fmt.Sprintf("older than %v", *newerThan), nil)
+				continue
+			}
+		}
+
+		if *localOnly {
+			reason := localOnlyReason(upstreams[candidate.Name], remoteHeads, *remote, candidate.Name)
+			trace.check("never pushed", reason == "")
+			if reason != "" {
+				if *verbose {
+					logf("Branch %s %s, skipping\n", branch, reason)
+				}
+				results.record(branch, actionKept, reason, nil)
+				continue
+			}
+			if *olderThan > 0 {
+				lastCommit, err := getLastCommitTime(ctx, ref)
+				if err != nil {
+					logf("Error getting last commit of branch %s: %v\n", branch, err)
+					results.record(branch, actionError, fmt.Sprintf("getting last commit: %v", err), nil)
+					continue
+				}
+				age := time.Since(lastCommit)
+				trace.check(fmt.Sprintf("last commit older than -older-than %v", *olderThan), age > *olderThan)
+				if age <= *olderThan {
+					if *verbose {
+						logf("Branch %s was never pushed but was last committed to %v ago, skipping\n", branch, age.Round(time.Minute))
+					}
+					results.record(branch, actionKept, fmt.Sprintf("never pushed, newer than %v", *olderThan), nil)
+					continue
+				}
+			}
+			reason, err := runSafetyChecks(ctx, localSafetyChecks, candidate, nil)
+			if err != nil {
+				logf("Error running safety checks for branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("running safety checks: %v", err), nil)
+				continue
+			}
+			trace.check("safety checks passed", reason == "")
+			if reason != "" {
+				logf("Branch %s is %s, skipping (use -force-unsafe to bypass safety checks)\n", branch, reason)
+				results.record(branch, actionKept, reason, nil)
+				continue
+			}
+			logf("Branch %s was never pushed to %s, deleting\n", branch, *remote)
+			deleteCandidate(candidate, pendingDeletion{branch: branch, reason: "never pushed"})
+			continue
+		}
+
+		if *teamBranches {
+			owned, err := ownedByTeam(ctx, rules, *codeowner, base, ref)
+			if err != nil {
+				logf("Error checking owners of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("checking owners: %v", err), nil)
+				continue
+			}
+			trace.check(fmt.Sprintf("all changed files owned by %s", *codeowner), owned)
+			if !owned {
+				if *verbose {
+					logf("Branch %s changes files not owned by %s, skipping\n", branch, *codeowner)
+				}
+				trace.print(branch, "skipped", "not owned by -as")
+				continue
+			}
+		}
+
+		headRef := candidate.Name
+		if candidate.Remote == "" {
+			headRef = mapper.headRef(candidate.Name)
+		}
+		if headRef != candidate.Name && *verbose {
+			logf("Looking up branch %s as %s\n", branch, headRef)
+		}
+
+		release, ok := draftReleaseTargets[headRef]
+		if *checkReleases {
+			trace.check("target of a draft release", ok)
+		}
+		if ok {
+			logf("Branch %s is the target of draft release %s, skipping\n", branch, release)
+			results.record(branch, actionKept, fmt.Sprintf("target of draft release %s", release), nil)
+			continue
+		}
+
+		var prs pullRequests
+		if imported != nil {
+			var ok bool
+			prs, ok = imported.PullRequests[headRef]
+			if !ok {
+				logf("Branch %s isn't in the -pr-import file, skipping\n", branch)
+				results.record(branch, actionKept, "not in -pr-import file", nil)
+				continue
+			}
+		} else if groups != nil {
+			prs, err = groups.lookup(ctx, client, owner, repo, headRef, *prLookback, *apiPageSize, headOwner)
+		} else {
+			prs, err = getAllPullRequests(ctx, client, owner, repo, headRef, *prLookback, *apiPageSize, headOwner)
+		}
+		if err != nil {
+			logf("Error getting pull requests for branch %s: %v\n", branch, err)
+			results.record(branch, actionError, fmt.Sprintf("getting pull requests: %v", err), nil)
+			continue
+		}
 
-	// Get flags
-	safeMode := flag.Bool("safe", false, "Enable safe mode")
-	forceMode := flag.Bool("force", false, "Enable deleting closed branches, not just merged")
-	flag.Parse()
+		if exported != nil {
+			exported.PullRequests[headRef] = prs
+		}
 
-	// Create context
-	ctx := context.Background()
+		if *ignoreForkPrs {
+			prs = prs.fromOwner(owner)
+		}
 
-	// Get token from GH CLI
-	err, token := getToken()
-	if err != nil {
-		fmt.Printf("Failed to get current Github repo: %v\n", err)
-		return
-	}
+		if !prStateFilter.matches(prs) {
+			trace.print(branch, "skipped", "pull request states don't match -filter-pr-state")
+			continue
+		}
 
-	client := getGraphqlClient(token, ctx)
+		// Without pull requests only git can say the branch is merged, which the
+		// git and either policies accept.
+		trace.check("pull requests found", len(prs) > 0)
+		if len(prs) == 0 {
+			gitMerged := false
+			if *mergedPolicy == mergedPolicyGit || *mergedPolicy == mergedPolicyEither {
+				gitMerged, err = isAncestor(ctx, ref, base)
+				if err != nil {
+					logf("Error checking whether branch %s is merged: %v\n", branch, err)
+					results.record(branch, actionError, fmt.Sprintf("checking merged: %v", err), nil)
+					continue
+				}
+				trace.check(fmt.Sprintf("merged into %s", defaultBranch), gitMerged)
+			}
+			if !gitMerged {
+				logf("No pull requests found for branch %s\n", branch)
+				results.record(branch, actionKept, "no pull requests found", nil)
+				continue
+			}
+			logf("No pull requests found for branch %s, but it is merged into %s\n", branch, defaultBranch)
+		}
+		prUrls := prs.getPrUrls(linker)
+		if groups != nil {
+			if first := groups.add(branch, prs); first != "" {
+				logf("Branch %s has the same pull requests as branch %s\n", branch, first)
+			}
+		}
 
-	owner, repo, defaultBranch, err := getCurrentGithubRepo()
-	if err != nil {
-		fmt.Printf("Failed to get current Github repo: %v\n", err)
-		return
-	}
+		if *olderThan > 0 || !lastRun.IsZero() {
+			lastActive, ok, err := getBranchAgeTime(ctx, ref, prs, *ageSource, *ageFallback)
+			if err != nil {
+				logf("Error getting age of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("getting branch age: %v", err), prs)
+				continue
+			}
+			trace.check("age known", ok)
+			if !ok {
+				logf("Branch %s has no merged pull requests to measure age from, skipping\n", branch)
+				results.record(branch, actionKept, "no merged pull requests to measure age from", prs)
+				continue
+			}
+			age := time.Since(lastActive)
+			if *olderThan > 0 {
+				trace.check(fmt.Sprintf("older than -older-than %v", *olderThan), age >= *olderThan)
+				if age < *olderThan {
+					logf("Branch %s is newer than %v (%v), skipping\n", branch, *olderThan, age.Round(time.Minute))
+					results.record(branch, actionKept, fmt.Sprintf("newer than %v", *olderThan), prs)
+					continue
+				}
+			}
+			if !lastRun.IsZero() {
+				// A pull request merged or closed since the last run counts as activity
+				// even when the branch itself has no new commits.
+				lastActive = prs.latestActivity(lastActive)
+				trace.check("active since the last run", !lastActive.Before(lastRun))
+				if lastActive.Before(lastRun) {
+					logf("Branch %s was last active before the last run at %s, skipping\n", branch, lastRun.Local().Format(time.DateTime))
+					results.record(branch, actionKept, "unchanged since the last run", prs)
+					continue
+				}
+			}
+		}
 
-	// Getting local git branches
-	branchList, err := getBranches()
-	if err != nil {
-		fmt.Printf("Failed to get branches: %v\n", err)
-		return
-	}
+		status := prs.statusSummary()
+		branchMerged, err := isBranchMerged(ctx, *mergedPolicy, status, ref, base)
+		if err != nil {
+			logf("Error checking whether branch %s is merged: %v\n", branch, err)
+			results.record(branch, actionError, fmt.Sprintf("checking merged: %v", err), prs)
+			continue
+		}
+		if bases := prs.mergedIntoDeletedBases(); len(bases) > 0 && *verbose {
+			logf("Branch %s was merged into since deleted base branches %s, still treating it as merged\n", branch, strings.Join(bases, ", "))
+		}
+		trace.check(fmt.Sprintf("merged according to -merged-policy %s", *mergedPolicy), branchMerged)
+		trace.check("any pull requests open", status.Open > 0)
+		trace.check("any pull requests closed", status.Closed > 0)
+		trace.check("-force set", *forceMode)
 
-	// Sanitise the branches
-	sanitisedBranches := branchList.sanitiseBranches(defaultBranch)
+		if branchMerged && *minAgeMerged > 0 {
+			mergedAt, ok := prs.lastMergedAt()
+			trace.check(fmt.Sprintf("merged less than -min-age-merged %v ago", *minAgeMerged), ok && time.Since(mergedAt) < *minAgeMerged)
+			if ok && time.Since(mergedAt) < *minAgeMerged {
+				logf("Branch %s was merged %v ago, keeping until it is at least %v old\n", branch, time.Since(mergedAt).Round(time.Minute), *minAgeMerged)
+				results.record(branch, actionKept, fmt.Sprintf("merged less than %v ago", *minAgeMerged), prs)
+				continue
+			}
+		}
 
-	for _, branch := range sanitisedBranches {
+		// An open pull request always keeps the branch, closed ones only keep it without -force,
+		// unless they were all opened by a bot or closed long enough ago to count as abandoned.
+		closedByBots := !branchMerged && prs.allOpenedByBots(bots)
+		trace.check("closed pull requests all opened by -bot-authors", closedByBots)
+		abandoned := false
+		if *deleteClosedOlderThan > 0 && !branchMerged && status.Open == 0 && status.Merged == 0 {
+			closedAt, ok := prs.lastClosedAt()
+			abandoned = ok && time.Since(closedAt) > *deleteClosedOlderThan
+			trace.check(fmt.Sprintf("closed longer ago than -delete-closed-older-than %v", *deleteClosedOlderThan), abandoned)
+		}
+		canDeleteBranch := status.Open == 0 && (branchMerged || *forceMode || closedByBots || abandoned)
+		if canDeleteBranch {
+			reason, err := runSafetyChecks(ctx, safetyChecks, candidate, prs)
+			if err != nil {
+				logf("Error running safety checks for branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("running safety checks: %v", err), prs)
+				continue
+			}
+			trace.check("safety checks passed", reason == "")
+			if reason != "" {
+				logf("Branch %s is %s, skipping (use -force-unsafe to bypass safety checks)\n", branch, reason)
+				results.record(branch, actionKept, reason, prs)
+				continue
+			}
+		}
 
-		prs, err := getAllPullRequests(ctx, client, owner, repo, branch)
-		if err != nil {
-			fmt.Printf("Error getting pull requests for branch %s: %v\n", branch, err)
-			return
+		if canDeleteBranch && *requirePassingChecks {
+			reason, err := checkMergedPrChecks(ctx, client, owner, repo, prs)
+			if err != nil {
+				logf("Error checking status checks of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("checking status checks: %v", err), prs)
+				continue
+			}
+			trace.check("merged pull requests passed their checks", reason == "")
+			if reason != "" {
+				logf("Branch %s was %s, skipping\n", branch, reason)
+				results.record(branch, actionKept, reason, prs)
+				continue
+			}
 		}
 
-		if prs == nil {
-			fmt.Printf("No pull requests found for branch %s\n", branch)
-			continue
+		if canDeleteBranch && len(protectedPathPatterns) > 0 && !*forceMode {
+			file, err := touchedProtectedPath(ctx, protectedPathPatterns, base, ref)
+			if err != nil {
+				logf("Error checking changed files of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("checking changed files: %v", err), prs)
+				continue
+			}
+			trace.check("changes a -protect-path file", file != "")
+			if file != "" {
+				logf("Branch %s changes protected path %s, skipping (use -force to delete anyway)\n", branch, file)
+				results.record(branch, actionKept, fmt.Sprintf("changes protected path %s", file), prs)
+				continue
+			}
 		}
 
-		anyPrsClosed := prs.areAnyPRsClosed()
-		noPrsOpen := !prs.areAnyPRsOpen()
+		if canDeleteBranch && tagRef != "" {
+			reason := ""
+			if status.Merged == 0 {
+				reason = fmt.Sprintf("no merged pull requests to find in %s", *sinceTag)
+			} else if reason, err = checkMergeCommits(ctx, prs, tagRef); err != nil {
+				logf("Error checking branch %s against tag %s: %v\n", branch, *sinceTag, err)
+				results.record(branch, actionError, fmt.Sprintf("checking tag %s: %v", *sinceTag, err), prs)
+				continue
+			}
+			trace.check(fmt.Sprintf("merged into -since-tag %s", *sinceTag), reason == "")
+			if reason != "" {
+				logf("Branch %s has %s, skipping\n", branch, reason)
+				results.record(branch, actionKept, reason, prs)
+				continue
+			}
+		}
 
-		if anyPrsClosed && *forceMode {
-			fmt.Printf("Deleting branch `%s` even with closed pull requests\n", branch)
+		if canDeleteBranch && *mergeCommitCheck {
+			reason, err := checkMergeCommits(ctx, prs, base)
+			if err != nil {
+				logf("Error checking merge commits of branch %s: %v\n", branch, err)
+				results.record(branch, actionError, fmt.Sprintf("checking merge commits: %v", err), prs)
+				continue
+			}
+			trace.check("merge commits in the default branch", reason == "")
+			if reason != "" {
+				logf("Branch %s has %s, skipping\n", branch, reason)
+				results.record(branch, actionKept, reason, prs)
+				continue
+			}
 		}
 
-		canDeleteBranch := prs.areAllPRsMerged() || (anyPrsClosed && noPrsOpen && *forceMode)
 		if canDeleteBranch {
-			deleteBranch(branch, *safeMode)
-		} else {
-			if !noPrsOpen {
-				fmt.Printf("Branch %s has open pull requests: %v\n", branch, prs.getUnmergedPrUrls(owner, repo))
+			if *showDiffstat {
+				printDiffStat(ctx, base, ref)
 			}
-			if anyPrsClosed {
-				fmt.Printf("Branch %s has closed pull requests: %v\n", branch, prs.getClosedPrUrls(owner, repo))
-				fmt.Printf("Use -force flag to delete branches with closed pull requests\n")
+			reason := "all pull requests merged"
+			if *mergedPolicy != mergedPolicyPr {
+				reason = fmt.Sprintf("merged according to -merged-policy %s", *mergedPolicy)
 			}
+			if closedByBots {
+				reason = "closed pull requests opened by bots"
+				logf("Deleting branch `%s` with closed pull requests opened by bots (%s)\n", branch, status)
+			} else if abandoned {
+				reason = fmt.Sprintf("pull requests closed more than %v ago", *deleteClosedOlderThan)
+				logf("Deleting branch `%s` with pull requests closed more than %v ago (%s)\n", branch, *deleteClosedOlderThan, status)
+			} else if !branchMerged {
+				reason = "closed pull requests deleted with -force"
+				logf("Deleting branch `%s` even with closed pull requests (%s)\n", branch, status)
+			}
+			if candidate.Remote != "" && !*forceMode {
+				target := "refs/remotes/" + candidate.Remote + "/" + defaultBranch
+				if *baseCommit != "" {
+					target = base
+				}
+				reason, err := checkRemoteTipMerged(ctx, candidate, target, prs, closedByBots || abandoned)
+				if err != nil {
+					logf("Error checking remote branch %s is merged: %v\n", branch, err)
+					results.record(branch, actionError, fmt.Sprintf("checking remote tip: %v", err), prs)
+					continue
+				}
+				trace.check("remote tip merged", reason == "")
+				if reason != "" {
+					logf("Warning: remote branch %s %s, skipping (use -force to delete anyway)\n", branch, reason)
+					results.record(branch, actionKept, reason, prs)
+					continue
+				}
+			}
+
+			if *preDeleteCheck != "" {
+				reason := runPreDeleteCheck(ctx, *preDeleteCheck, *hookTimeout, *verbose, branch, prUrls)
+				trace.check("pre-delete check passed", reason == "")
+				if reason != "" {
+					logf("Branch %s was %s, skipping\n", branch, reason)
+					results.record(branch, actionKept, reason, prs)
+					continue
+				}
+			}
+
+			var commit, upstream string
+			if *recreateTracking && candidate.Remote == "" {
+				commit, err = getCommit(ctx, ref)
+				if err == nil {
+					upstream, err = getUpstream(ctx, ref)
+				}
+				if err != nil {
+					logf("Error getting tracking information for branch %s: %v\n", branch, err)
+					results.record(branch, actionError, fmt.Sprintf("getting tracking information: %v", err), prs)
+					continue
+				}
+			}
+
+			deleteCandidate(candidate, pendingDeletion{branch: branch, reason: reason, prs: prs, commit: commit, upstream: upstream})
+		} else if status.Open > 0 {
+			logf("Branch %s has open pull requests (%s): %v\n", branch, status, prs.getUnmergedPrUrls(linker))
+			results.record(branch, actionKept, fmt.Sprintf("open pull requests (%s)", status), prs)
+		} else {
+			logf("Branch %s has closed pull requests (%s): %v\n", branch, status, prs.getClosedPrUrls(linker))
+			logf("Use -force flag to delete branches with closed pull requests\n")
+			results.record(branch, actionKept, fmt.Sprintf("closed pull requests (%s), use -force to delete", status), prs)
+		}
+	}
+	finished = true
+}
+
+// getBranchAgeTime returns the time a branch's age is measured from, based on the age source.
+// The boolean is false when the branch has no usable timestamp and should be skipped.
+func getBranchAgeTime(ctx context.Context, branch string, prs pullRequests, ageSource string, ageFallback string) (time.Time, bool, error) {
+	if ageSource == "merged" {
+		if mergedAt, ok := prs.lastMergedAt(); ok {
+			return mergedAt, true, nil
 		}
+		if ageFallback == "skip" {
+			return time.Time{}, false, nil
+		}
+	}
+	lastCommit, err := getLastCommitTime(ctx, branch)
+	if err != nil {
+		return time.Time{}, false, err
 	}
+	return lastCommit, true, nil
 }
 
-func getBranches() (branches, error) {
-	cmd := exec.Command("git", "branch", "-l")
-	output, err := cmd.Output()
+// checkRemoteTipMerged verifies the branch's current tip on the remote is either contained in
+// target, usually the remote default branch, or is the head of a merged pull request, so commits
+// pushed after the merge aren't lost. With acceptClosed, the head of a closed pull request is
+// accepted too, for branches deleted because their pull requests were closed rather than merged.
+// It returns a reason to keep the branch, or an empty string if it's safe to delete.
+func checkRemoteTipMerged(ctx context.Context, candidate branchCandidate, target string, prs pullRequests, acceptClosed bool) (string, error) {
+	tip, err := getRemoteBranchTip(ctx, candidate.Remote, candidate.Name)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if tip == "" {
+		return "no longer exists on the remote", nil
+	}
+	for _, pr := range prs {
+		if string(pr.HeadRefOid) != tip {
+			continue
+		}
+		if pr.State == githubv4.PullRequestStateMerged || (acceptClosed && pr.State == githubv4.PullRequestStateClosed) {
+			return "", nil
+		}
+	}
+	contained, err := isAncestor(ctx, tip, target)
+	target = strings.TrimPrefix(target, "refs/remotes/")
+	if err != nil {
+		return fmt.Sprintf("has tip %.7s that can't be checked against %s (run git fetch)", tip, target), nil
+	}
+	if !contained {
+		return fmt.Sprintf("has commits at %.7s that aren't merged into %s", tip, target), nil
+	}
+	return "", nil
+}
+
+// checkMergeCommits checks that the merge commit of every merged pull request
+// is reachable from base, returning why not for the first that isn't. A merge
+// commit that isn't available locally usually means base is behind.
+func checkMergeCommits(ctx context.Context, prs pullRequests, base string) (string, error) {
+	for _, pr := range prs {
+		if !pr.Merged || pr.MergeCommit == nil {
+			continue
+		}
+		oid := string(pr.MergeCommit.Oid)
+		if _, err := getCommit(ctx, oid); err != nil {
+			return fmt.Sprintf("merge commit %.7s of #%d that isn't available locally (run git fetch)", oid, pr.Number), nil
+		}
+		merged, err := isAncestor(ctx, oid, base)
+		if err != nil {
+			return "", err
+		}
+		if !merged {
+			return fmt.Sprintf("merge commit %.7s of #%d that isn't in %s", oid, pr.Number, base), nil
+		}
 	}
-	branchList := strings.Split(string(output), "\n")
-	return branchList, err
+	return "", nil
 }
 
-func getGraphqlClient(token string, ctx context.Context) *githubv4.Client {
+func getHttpClient(token string, ctx context.Context) *http.Client {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := githubv4.NewClient(tc)
+	return oauth2.NewClient(ctx, ts)
+}
+
+// githubAPIURLs returns the GraphQL endpoint and REST API base URL for a host,
+// using the /api paths of Github Enterprise Server for hosts other than
+// github.com.
+func githubAPIURLs(host string) (string, string) {
+	if host == "github.com" {
+		return "https://api.github.com/graphql", "https://api.github.com"
+	}
+	return "https://" + host + "/api/graphql", "https://" + host + "/api/v3"
+}
+
+func getGraphqlClient(httpClient *http.Client, graphqlURL string) *githubv4.Client {
+	client := githubv4.NewEnterpriseClient(graphqlURL, httpClient)
 	return client
 }
 
-func getToken() (error, string) {
-	tokenBytes, err := exec.Command("gh", "auth", "token").Output()
+var tokenEnvVars = []string{"GH_TOKEN", "GITHUB_TOKEN"}
+
+// getToken reads the token from tokenFile when one is given, otherwise gets it
+// from the GH CLI, falling back to the tokenEnvVars environment variables. With
+// useGh false only the environment is checked.
+func getToken(tokenFile string, useGh bool) (error, string) {
+	if tokenFile != "" {
+		token, err := readTokenFile(tokenFile)
+		return err, token
+	}
+	var ghErr error
+	if useGh {
+		token, err := getGhToken()
+		if err == nil {
+			return nil, token
+		}
+		ghErr = err
+	}
+	for _, envVar := range tokenEnvVars {
+		if token := strings.TrimSpace(os.Getenv(envVar)); token != "" {
+			return nil, token
+		}
+	}
+	if ghErr != nil {
+		return fmt.Errorf("gh auth token failed and none of %s are set: %w", strings.Join(tokenEnvVars, ", "), ghErr), ""
+	}
+	return fmt.Errorf("-no-gh requires a token in one of %s", strings.Join(tokenEnvVars, ", ")), ""
+}
+
+func getGhToken() (string, error) {
+	tokenBytes, err := commandOutput(exec.Command("gh", "auth", "token"))
 	if err != nil {
-		return err, ""
+		return "", err
 	}
-	token := strings.TrimSpace(string(tokenBytes[:]))
-	return err, token
+	return strings.TrimSpace(string(tokenBytes[:])), nil
 }
 
-func deleteBranch(branch string, safeMode bool) {
-	fmt.Printf("Deleting branch: %s\n", branch)
-	if safeMode {
-		fmt.Printf("Safe mode enabled, skipping deletion...\n")
-	} else {
-		deleteCmd := exec.Command("git", "branch", "-D", branch)
-		if err := deleteCmd.Run(); err != nil {
-			fmt.Printf("Failed to delete branch %s: %v\n", branch, err)
-		}
+// readTokenFile reads a token from a file, warning when the file can be read by
+// other users. The token itself is never included in errors.
+func readTokenFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
 	}
+	if info.Mode().Perm()&0077 != 0 {
+		logf("Warning: token file %s is accessible by other users (mode %v)\n", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
 }
 
-func getCurrentGithubRepo() (string, string, string, error) {
+func getCurrentGithubRepo(ctx context.Context) (remoteRepository, string, error) {
 	type GithubRepoOutput struct {
 		Name             string `json:"name"`
+		Url              string `json:"url"`
 		DefaultBranchRef struct {
 			Name string `json:"name"`
 		} `json:"defaultBranchRef"`
@@ -143,22 +1590,47 @@ func getCurrentGithubRepo() (string, string, string, error) {
 		} `json:"owner"`
 	}
 
-	cmd := exec.Command("gh", "repo", "view", "--json", "owner,name,defaultBranchRef")
-	output, err := cmd.Output()
+	cmd := exec.CommandContext(ctx, "gh", "repo", "view", "--json", "owner,name,url,defaultBranchRef")
+	output, err := commandOutput(cmd)
 	if err != nil {
-		return "", "", "", err
+		return remoteRepository{}, "", err
 	}
 
 	var repo GithubRepoOutput
 	err = json.Unmarshal(output, &repo)
 	if err != nil {
-		return "", "", "", err
+		return remoteRepository{}, "", err
 	}
 
-	return repo.Owner.Login, repo.Name, repo.DefaultBranchRef.Name, nil
+	repoURL, err := url.Parse(repo.Url)
+	if err != nil {
+		return remoteRepository{}, "", err
+	}
+
+	return remoteRepository{Host: repoURL.Host, Owner: repo.Owner.Login, Repo: repo.Name}, repo.DefaultBranchRef.Name, nil
+}
+
+func isRepositoryArchived(ctx context.Context, client graphqlQuerier, owner string, repo string) (bool, error) {
+	var query struct {
+		Repository struct {
+			IsArchived bool
+		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
+	}
+	variables := map[string]interface{}{
+		"repositoryOwner": githubv4.String(owner),
+		"repositoryName":  githubv4.String(repo),
+	}
+	if err := client.Query(ctx, &query, variables); err != nil {
+		return false, err
+	}
+	return query.Repository.IsArchived, nil
 }
 
-func getAllPullRequests(ctx context.Context, client *githubv4.Client, owner string, repo string, branch string) (pullRequests, error) {
+// getAllPullRequests returns the pull requests with the branch as their head ref. When lookback is
+// non-zero, pull requests last updated longer ago than lookback are ignored. When headOwner is set,
+// only an open pull request from a head repository it owns stops paging early, as the caller
+// ignores the rest.
+func getAllPullRequests(ctx context.Context, client graphqlQuerier, owner string, repo string, branch string, lookback time.Duration, pageSize int, headOwner string) (pullRequests, error) {
 	var query struct {
 		Repository struct {
 			PullRequests struct {
@@ -167,17 +1639,23 @@ func getAllPullRequests(ctx context.Context, client *githubv4.Client, owner stri
 					EndCursor   githubv4.String
 					HasNextPage bool
 				}
-			} `graphql:"pullRequests(headRefName: $branchName, first: 100, after: $cursor)"` // 100 per page.
+			} `graphql:"pullRequests(headRefName: $branchName, orderBy: $orderBy, first: $pageSize, after: $cursor)"`
 		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
 	}
 	variables := map[string]interface{}{
 		"repositoryOwner": githubv4.String(owner),
 		"repositoryName":  githubv4.String(repo),
 		"branchName":      githubv4.String(branch),
+		"orderBy":         githubv4.IssueOrder{Field: githubv4.IssueOrderFieldUpdatedAt, Direction: githubv4.OrderDirectionDesc},
+		"pageSize":        githubv4.Int(pageSize),
 		"cursor":          (*githubv4.String)(nil), // Null after argument to get first page.
 	}
 
 	var allPullRequests []pullRequest
+	var cutoff time.Time
+	if lookback > 0 {
+		cutoff = time.Now().Add(-lookback)
+	}
 
 	for {
 		err := client.Query(ctx, &query, variables)
@@ -187,8 +1665,24 @@ func getAllPullRequests(ctx context.Context, client *githubv4.Client, owner stri
 		if query.Repository.PullRequests.Nodes == nil {
 			break
 		}
-		allPullRequests = append(allPullRequests, query.Repository.PullRequests.Nodes...)
+		reachedCutoff := false
+		for _, pr := range query.Repository.PullRequests.Nodes {
+			if pr.UpdatedAt.Before(cutoff) {
+				reachedCutoff = true
+				continue
+			}
+			allPullRequests = append(allPullRequests, pr)
+		}
 
+		// An open pull request always keeps the branch, so there's no need to fetch older pages.
+		// Pages are ordered by most recently updated, so once the cutoff is reached the rest are older too.
+		page := query.Repository.PullRequests.Nodes
+		if headOwner != "" {
+			page = page.fromOwner(headOwner)
+		}
+		if page.areAnyPRsOpen() || reachedCutoff {
+			break
+		}
 		if !query.Repository.PullRequests.PageInfo.HasNextPage {
 			break
 		}
@@ -198,22 +1692,202 @@ func getAllPullRequests(ctx context.Context, client *githubv4.Client, owner stri
 	return allPullRequests, nil
 }
 
-func (p pullRequests) areAllPRsMerged() bool {
+const defaultPrUrlTemplate = "https://github.com/{owner}/{repo}/pull/{number}"
+
+// prLinker builds links to pull requests in a repository from a URL template,
+// so links are correct for Github Enterprise and other hosts.
+type prLinker struct {
+	template string
+	owner    string
+	repo     string
+}
+
+func (l prLinker) url(number int) string {
+	return strings.NewReplacer(
+		"{owner}", l.owner,
+		"{repo}", l.repo,
+		"{number}", strconv.Itoa(number),
+	).Replace(l.template)
+}
+
+// prStatusSummary counts a branch's pull requests by state. Drafts are counted
+// separately as well as under their state.
+type prStatusSummary struct {
+	Merged int
+	Open   int
+	Closed int
+	Draft  int
+}
+
+func (p pullRequests) statusSummary() prStatusSummary {
+	var summary prStatusSummary
 	for _, pr := range p {
-		if !pr.Merged {
+		switch pr.State {
+		case githubv4.PullRequestStateMerged:
+			summary.Merged++
+		case githubv4.PullRequestStateOpen:
+			summary.Open++
+		case githubv4.PullRequestStateClosed:
+			summary.Closed++
+		}
+		if pr.IsDraft {
+			summary.Draft++
+		}
+	}
+	return summary
+}
+
+func (s prStatusSummary) allMerged() bool {
+	return s.Merged > 0 && s.Open == 0 && s.Closed == 0
+}
+
+func (s prStatusSummary) String() string {
+	var parts []string
+	if s.Merged > 0 {
+		parts = append(parts, fmt.Sprintf("%d merged", s.Merged))
+	}
+	if s.Open > 0 {
+		parts = append(parts, fmt.Sprintf("%d open", s.Open))
+	}
+	if s.Closed > 0 {
+		parts = append(parts, fmt.Sprintf("%d closed", s.Closed))
+	}
+	if s.Draft > 0 {
+		parts = append(parts, fmt.Sprintf("%d draft", s.Draft))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// prStateFilter is a set of pull request states, plus "NONE" for branches
+// without pull requests. An empty filter matches every branch.
+type prStateFilter map[string]bool
+
+func parsePrStateFilter(value string) (prStateFilter, error) {
+	filter := make(prStateFilter)
+	for _, state := range strings.Split(value, ",") {
+		state = strings.ToUpper(strings.TrimSpace(state))
+		switch state {
+		case "":
+			continue
+		case "OPEN", "CLOSED", "MERGED", "NONE":
+			filter[state] = true
+		default:
+			return nil, fmt.Errorf("unknown state %q, must be one of: OPEN, CLOSED, MERGED, NONE", state)
+		}
+	}
+	return filter, nil
+}
+
+func (f prStateFilter) matches(prs pullRequests) bool {
+	if len(f) == 0 {
+		return true
+	}
+	if len(prs) == 0 {
+		return f["NONE"]
+	}
+	for _, pr := range prs {
+		if f[string(pr.State)] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedIntoDeletedBases returns the names of deleted base branches that pull
+// requests were merged into. Those pull requests still count as merged.
+func (p pullRequests) mergedIntoDeletedBases() []string {
+	var bases []string
+	for _, pr := range p {
+		if pr.Merged && pr.BaseRef == nil && !slices.Contains(bases, pr.BaseRefName) {
+			bases = append(bases, pr.BaseRefName)
+		}
+	}
+	return bases
+}
+
+// fromOwner returns the pull requests opened from a repository owned by owner,
+// or nil if there are none. Pull requests from deleted repositories are left
+// out, since they can't have come from the repository itself.
+func (p pullRequests) fromOwner(owner string) pullRequests {
+	var matching pullRequests
+	for _, pr := range p {
+		if pr.HeadRepositoryOwner != nil && strings.EqualFold(pr.HeadRepositoryOwner.Login, owner) {
+			matching = append(matching, pr)
+		}
+	}
+	return matching
+}
+
+// allOpenedByBots reports whether every pull request was opened by one of the
+// bots. Bots are matched by login with any [bot] suffix removed.
+func (p pullRequests) allOpenedByBots(bots []string) bool {
+	if len(p) == 0 || len(bots) == 0 {
+		return false
+	}
+	for _, pr := range p {
+		if pr.Author == nil || !slices.Contains(bots, strings.ToLower(strings.TrimSuffix(pr.Author.Login, "[bot]"))) {
 			return false
 		}
 	}
 	return true
 }
 
-func (p pullRequests) areAnyPRsClosed() bool {
+func parseBotAuthors(value string) []string {
+	var bots []string
+	for _, bot := range strings.Split(value, ",") {
+		if bot = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(bot), "[bot]")); bot != "" {
+			bots = append(bots, bot)
+		}
+	}
+	return bots
+}
+
+func (p pullRequests) lastMergedAt() (time.Time, bool) {
+	var last time.Time
 	for _, pr := range p {
-		if pr.State == "CLOSED" {
-			return true
+		if pr.Merged && pr.MergedAt != nil && pr.MergedAt.After(last) {
+			last = pr.MergedAt.Time
 		}
 	}
-	return false
+	return last, !last.IsZero()
+}
+
+// lastClosedAt returns when the most recently closed, unmerged pull request
+// was closed.
+func (p pullRequests) lastClosedAt() (time.Time, bool) {
+	var last time.Time
+	for _, pr := range p {
+		if pr.State == githubv4.PullRequestStateClosed && pr.ClosedAt != nil && pr.ClosedAt.After(last) {
+			last = pr.ClosedAt.Time
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// latestActivity returns the latest of since and the times each pull request
+// was last updated, merged or closed.
+func (p pullRequests) latestActivity(since time.Time) time.Time {
+	latest := since
+	for _, pr := range p {
+		latest = latestTime(latest, pr.UpdatedAt.Time)
+		if pr.MergedAt != nil {
+			latest = latestTime(latest, pr.MergedAt.Time)
+		}
+		if pr.ClosedAt != nil {
+			latest = latestTime(latest, pr.ClosedAt.Time)
+		}
+	}
+	return latest
+}
+
+func latestTime(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
 }
 
 func (p pullRequests) areAnyPRsOpen() bool {
@@ -225,34 +1899,139 @@ func (p pullRequests) areAnyPRsOpen() bool {
 	return false
 }
 
-func (p pullRequests) getUnmergedPrUrls(owner string, repo string) []string {
+func (p pullRequests) getPrUrls(linker prLinker) []string {
+	var prUrls = make([]string, 0)
+	for _, pr := range p {
+		prUrls = append(prUrls, linker.url(pr.Number))
+	}
+	return prUrls
+}
+
+func (p pullRequests) getUnmergedPrUrls(linker prLinker) []string {
 	var prUrls = make([]string, 0)
 	for _, pr := range p {
 		if !pr.Merged {
-			prUrls = append(prUrls, fmt.Sprintf("https://github.com/%s/%s/pull/%d", owner, repo, pr.Number))
+			prUrls = append(prUrls, linker.url(pr.Number))
+		}
+	}
+	return prUrls
+}
+
+func (p pullRequests) getOpenPrUrls(linker prLinker) []string {
+	var prUrls = make([]string, 0)
+	for _, pr := range p {
+		if pr.State == "OPEN" {
+			prUrls = append(prUrls, linker.url(pr.Number))
 		}
 	}
 	return prUrls
 }
 
-func (p pullRequests) getClosedPrUrls(owner string, repo string) []string {
+func (p pullRequests) getClosedPrUrls(linker prLinker) []string {
 	var prUrls = make([]string, 0)
 	for _, pr := range p {
 		if pr.State == "CLOSED" {
-			prUrls = append(prUrls, fmt.Sprintf("https://github.com/%s/%s/pull/%d", owner, repo, pr.Number))
+			prUrls = append(prUrls, linker.url(pr.Number))
 		}
 	}
 	return prUrls
 }
 
-func (b branches) sanitiseBranches(defaultBranch string) branches {
+// printOpenPullRequests prints each open pull request with the branches it
+// keeps, for reviewing or closing them.
+func printOpenPullRequests(open []openPullRequest) {
+	if len(open) == 0 {
+		logf("No open pull requests are keeping branches\n")
+		return
+	}
+	logf("Open pull requests keeping branches:\n")
+	for _, pr := range open {
+		author := pr.Author
+		if author == "" {
+			author = "ghost"
+		}
+		logf("  #%d %s (@%s) %s\n", pr.Number, pr.Title, author, pr.URL)
+		logf("      branches: %s\n", strings.Join(pr.Branches, ", "))
+	}
+}
+
+// printRestoreCommand prints the git commands that recreate a deleted branch
+// and, when it had one, re-establish its upstream.
+func printRestoreCommand(branch string, commit string, upstream string) {
+	if upstream == "" {
+		logf("Restore branch %s with: git branch %s %s\n", branch, branch, commit)
+		return
+	}
+	logf("Restore branch %s with: git branch %s %s && git branch --set-upstream-to=%s %s\n", branch, branch, commit, upstream, branch)
+}
+
+// selectNamedBranches returns the branches named with -branch, warning about
+// and leaving out any that don't exist, are protected or are checked out.
+func selectNamedBranches(ctx context.Context, names []string, defaultBranch string, protectedBranches []string) (branches, error) {
+	currentBranch, err := getCurrentBranch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var selected branches
+	for _, branch := range names {
+		if err := checkBranchName(branch); err != nil {
+			logf("Warning: %v, skipping\n", err)
+			continue
+		}
+		exists, err := branchExists(ctx, branch)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !exists:
+			logf("Warning: branch %s does not exist, skipping\n", branch)
+		case branch == defaultBranch:
+			logf("Warning: branch %s is the default branch, skipping\n", branch)
+		case slices.Contains(protectedBranches, branch):
+			logf("Warning: branch %s is protected with -protect-branch, skipping\n", branch)
+		case branch == currentBranch:
+			logf("Warning: branch %s is checked out, skipping\n", branch)
+		case slices.Contains(selected, branch):
+		default:
+			selected = append(selected, branch)
+		}
+	}
+	return selected, nil
+}
+
+func (b branches) sanitiseBranches(defaultBranch string, protectedBranches []string, matcher branchMatcher) branches {
 	var returnBranches = make(branches, 0)
 	for _, branchVal := range b {
+		// Branches checked out in another worktree are listed with a "+ " prefix
+		// and can't be deleted.
+		if strings.HasPrefix(branchVal, "+ ") {
+			continue
+		}
 		branch := strings.TrimSpace(strings.TrimPrefix(branchVal, "* "))
-		if branch == "" || branch == defaultBranch {
+		// A detached HEAD is listed as a pseudo-branch such as "(HEAD detached at 1a2b3c4)".
+		if branch == "" || strings.HasPrefix(branch, "(") || branch == defaultBranch || slices.Contains(protectedBranches, branch) || !matcher.matches(branch) {
+			continue
+		}
+		if err := checkBranchName(branch); err != nil {
+			logf("Warning: %v, skipping\n", err)
 			continue
 		}
 		returnBranches = append(returnBranches, branch)
 	}
 	return returnBranches
 }
+
+// localOnlyReason returns why -local-only keeps a branch, telling a branch
+// whose upstream is gone apart from one that was never pushed, or an empty
+// string if it was never pushed.
+func localOnlyReason(upstream upstreamState, remoteHeads map[string]bool, remote string, branch string) string {
+	switch {
+	case upstream.Gone:
+		return fmt.Sprintf("was pushed, upstream %s is gone", upstream.Upstream)
+	case upstream.Upstream != "":
+		return fmt.Sprintf("tracks %s", upstream.Upstream)
+	case remoteHeads[branch]:
+		return fmt.Sprintf("exists on %s without being tracked", remote)
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+func TestGitHelpersStopWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := getBranches(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("getBranches() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := branchExists(ctx, "main"); !errors.Is(err, context.Canceled) {
+		t.Errorf("branchExists() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := getCommit(ctx, "HEAD"); !errors.Is(err, context.Canceled) {
+		t.Errorf("getCommit() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestStatusSummary(t *testing.T) {
+	merged := pullRequest{State: githubv4.PullRequestStateMerged, Merged: true}
+	open := pullRequest{State: githubv4.PullRequestStateOpen}
+	draft := pullRequest{State: githubv4.PullRequestStateOpen, IsDraft: true}
+	closed := pullRequest{State: githubv4.PullRequestStateClosed}
+
+	tests := []struct {
+		name       string
+		prs        pullRequests
+		want       prStatusSummary
+		wantMerged bool
+		wantString string
+	}{
+		{name: "none", prs: nil, want: prStatusSummary{}, wantMerged: false, wantString: "none"},
+		{name: "merged", prs: pullRequests{merged, merged}, want: prStatusSummary{Merged: 2}, wantMerged: true, wantString: "2 merged"},
+		{name: "open", prs: pullRequests{open}, want: prStatusSummary{Open: 1}, wantMerged: false, wantString: "1 open"},
+		{name: "draft", prs: pullRequests{draft}, want: prStatusSummary{Open: 1, Draft: 1}, wantMerged: false, wantString: "1 open, 1 draft"},
+		{name: "closed", prs: pullRequests{closed}, want: prStatusSummary{Closed: 1}, wantMerged: false, wantString: "1 closed"},
+		{name: "merged and open", prs: pullRequests{merged, open}, want: prStatusSummary{Merged: 1, Open: 1}, wantMerged: false, wantString: "1 merged, 1 open"},
+		{name: "merged and closed", prs: pullRequests{closed, merged}, want: prStatusSummary{Merged: 1, Closed: 1}, wantMerged: false, wantString: "1 merged, 1 closed"},
+		{name: "open and closed", prs: pullRequests{open, closed}, want: prStatusSummary{Open: 1, Closed: 1}, wantMerged: false, wantString: "1 open, 1 closed"},
+		{name: "every state", prs: pullRequests{merged, open, draft, closed}, want: prStatusSummary{Merged: 1, Open: 2, Closed: 1, Draft: 1}, wantMerged: false, wantString: "1 merged, 2 open, 1 closed, 1 draft"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.prs.statusSummary()
+			if got != test.want {
+				t.Errorf("statusSummary() = %+v, want %+v", got, test.want)
+			}
+			if merged := got.allMerged(); merged != test.wantMerged {
+				t.Errorf("allMerged() = %v, want %v", merged, test.wantMerged)
+			}
+			if text := got.String(); text != test.wantString {
+				t.Errorf("String() = %q, want %q", text, test.wantString)
+			}
+		})
+	}
+}
+
+func TestMergedIntoDeletedBases(t *testing.T) {
+	base := func(name string) *struct{ Name string } {
+		return &struct{ Name string }{Name: name}
+	}
+	prs := pullRequests{
+		// Merged into a release branch that was deleted once it shipped.
+		{Number: 1, Merged: true, State: githubv4.PullRequestStateMerged, BaseRefName: "release/1.0"},
+		{Number: 2, Merged: true, State: githubv4.PullRequestStateMerged, BaseRefName: "release/1.0"},
+		{Number: 3, Merged: true, State: githubv4.PullRequestStateMerged, BaseRefName: "main", BaseRef: base("main")},
+		// Closed without merging, so where it targeted doesn't matter.
+		{Number: 4, State: githubv4.PullRequestStateClosed, BaseRefName: "release/0.9"},
+		{Number: 5, Merged: true, State: githubv4.PullRequestStateMerged, BaseRefName: "hotfix"},
+	}
+
+	want := []string{"release/1.0", "hotfix"}
+	if got := prs.mergedIntoDeletedBases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergedIntoDeletedBases() = %q, want %q", got, want)
+	}
+	if got := prs[2:3].mergedIntoDeletedBases(); got != nil {
+		t.Errorf("mergedIntoDeletedBases() = %q for a base that still exists, want none", got)
+	}
+}
+
+func TestSanitiseBranches(t *testing.T) {
+	output := branches{
+		"* (HEAD detached at 1a2b3c4)",
+		"  feature/login",
+		"  main",
+		"+ feature/worktree",
+		"  keep-me",
+		"  release/1.0",
+		"  -rf",
+		"",
+	}
+	matcher, err := parseBranchMatcher("!release/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := output.sanitiseBranches("main", []string{"keep-me"}, matcher)
+	want := branches{"feature/login"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sanitiseBranches() = %q, want %q", got, want)
+	}
+}
+
+func TestLatestActivity(t *testing.T) {
+	lastRun := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lastCommit := lastRun.Add(-72 * time.Hour)
+	at := func(t time.Time) *githubv4.DateTime {
+		return &githubv4.DateTime{Time: t}
+	}
+
+	// The pull request was merged after the last run, but nothing was committed
+	// to the branch since, so its tip is older than the last run.
+	mergedAfter := pullRequests{{
+		State:     githubv4.PullRequestStateMerged,
+		Merged:    true,
+		UpdatedAt: githubv4.DateTime{Time: lastRun.Add(-48 * time.Hour)},
+		MergedAt:  at(lastRun.Add(2 * time.Hour)),
+		ClosedAt:  at(lastRun.Add(2 * time.Hour)),
+	}}
+	if got := mergedAfter.latestActivity(lastCommit); got.Before(lastRun) {
+		t.Errorf("latestActivity() = %v, want the merge after the last run at %v", got, lastRun)
+	}
+
+	closedBefore := pullRequests{{
+		State:     githubv4.PullRequestStateClosed,
+		UpdatedAt: githubv4.DateTime{Time: lastRun.Add(-24 * time.Hour)},
+		ClosedAt:  at(lastRun.Add(-24 * time.Hour)),
+	}}
+	if got, want := closedBefore.latestActivity(lastCommit), lastRun.Add(-24*time.Hour); !got.Equal(want) {
+		t.Errorf("latestActivity() = %v, want %v", got, want)
+	}
+
+	if got := pullRequests(nil).latestActivity(lastCommit); !got.Equal(lastCommit) {
+		t.Errorf("latestActivity() without pull requests = %v, want the last commit %v", got, lastCommit)
+	}
+}
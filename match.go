@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type matchPattern struct {
+	pattern string
+	negated bool
+}
+
+// branchMatcher selects branches with an ordered list of glob patterns, where
+// a leading ! excludes matching branches. Like .gitignore, the last pattern
+// that matches a branch decides whether it's selected, so later negations win.
+// Branches matching no pattern are selected only if there are no include
+// patterns. An empty matcher selects every branch.
+type branchMatcher []matchPattern
+
+// parseBranchMatcher parses a comma separated expression such as
+// 'feature/*,!feature/keep-*', validating each glob.
+func parseBranchMatcher(expression string) (branchMatcher, error) {
+	var matcher branchMatcher
+	for _, pattern := range strings.Split(expression, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		matcher = append(matcher, matchPattern{pattern: pattern, negated: negated})
+	}
+	return matcher, nil
+}
+
+func (m branchMatcher) matches(branch string) bool {
+	selected := true
+	for _, p := range m {
+		if !p.negated {
+			selected = false
+			break
+		}
+	}
+	for _, p := range m {
+		if ok, _ := path.Match(p.pattern, branch); ok {
+			selected = !p.negated
+		}
+	}
+	return selected
+}
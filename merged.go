@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Merged policies decide when a branch counts as merged:
+//
+//   - pr, the default, trusts Github: every pull request must be merged. This
+//     handles squash and rebase merges, but not branches merged outside a pull
+//     request.
+//   - git requires the branch tip to be an ancestor of the default branch. This
+//     works without pull requests, but misses squash and rebase merges and
+//     depends on the local default branch being up to date.
+//   - both requires both signals, the most conservative choice.
+//   - either accepts either signal, the most permissive choice.
+//
+// Under git and either, a branch without pull requests is merged when its tip
+// is; pr and both always keep it.
+const (
+	mergedPolicyPr     = "pr"
+	mergedPolicyGit    = "git"
+	mergedPolicyBoth   = "both"
+	mergedPolicyEither = "either"
+)
+
+var mergedPolicies = []string{mergedPolicyPr, mergedPolicyGit, mergedPolicyBoth, mergedPolicyEither}
+
+// isBranchMerged reports whether the branch counts as merged under the policy,
+// given its pull requests and whether git considers ref merged into base.
+func isBranchMerged(ctx context.Context, policy string, status prStatusSummary, ref string, base string) (bool, error) {
+	prMerged := status.allMerged()
+	if policy == mergedPolicyPr {
+		return prMerged, nil
+	}
+	gitMerged, err := isAncestor(ctx, ref, base)
+	if err != nil {
+		return false, err
+	}
+	switch policy {
+	case mergedPolicyGit:
+		return gitMerged, nil
+	case mergedPolicyBoth:
+		return prMerged && gitMerged, nil
+	case mergedPolicyEither:
+		return prMerged || gitMerged, nil
+	}
+	return false, fmt.Errorf("unknown merged policy %q", policy)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var metricNumbers = regexp.MustCompile(`[0-9]+`)
+
+// metricReason reduces a kept reason to a label value that stays the same
+// between runs, dropping details in parentheses or after a colon and
+// replacing numbers with N, so the reason label doesn't grow without bound.
+func metricReason(reason string) string {
+	reason, _, _ = strings.Cut(reason, " (")
+	reason, _, _ = strings.Cut(reason, ":")
+	return metricNumbers.ReplaceAllString(strings.TrimSpace(reason), "N")
+}
+
+func metricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Metrics writes the run's totals in the Prometheus text format, for the
+// node_exporter textfile collector.
+func (r *runResults) Metrics(w io.Writer, apiCalls int, duration time.Duration) error {
+	var sb strings.Builder
+	gauge := func(name string, help string) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	gauge("dob_branches_deleted_total", "Branches deleted by the last run.")
+	fmt.Fprintf(&sb, "dob_branches_deleted_total %d\n", r.count(actionDeleted))
+	gauge("dob_branches_would_delete_total", "Branches the last run would have deleted without -safe.")
+	fmt.Fprintf(&sb, "dob_branches_would_delete_total %d\n", r.count(actionWouldDelete))
+	gauge("dob_branches_kept_total", "Branches kept by the last run, by reason.")
+	reasons := make([]string, 0, len(r.keptReasons))
+	for reason := range r.keptReasons {
+		reasons = append(reasons, reason)
+	}
+	slices.Sort(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(&sb, "dob_branches_kept_total{reason=\"%s\"} %d\n", metricLabel(reason), r.keptReasons[reason])
+	}
+	gauge("dob_branches_errors_total", "Branches the last run failed to check or delete.")
+	fmt.Fprintf(&sb, "dob_branches_errors_total %d\n", r.count(actionError))
+	gauge("dob_api_calls_total", "Github API requests made by the last run.")
+	fmt.Fprintf(&sb, "dob_api_calls_total %d\n", apiCalls)
+	gauge("dob_run_duration_seconds", "How long the last run took.")
+	fmt.Fprintf(&sb, "dob_run_duration_seconds %.3f\n", duration.Seconds())
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeFileAtomically renders into a temporary file next to filePath and
+// renames it into place, so readers never see a partly written file.
+func writeFileAtomically(filePath string, render func(io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := render(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filePath)
+}
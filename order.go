@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"slices"
+)
+
+// sortTopologically orders candidates so branches stacked on top of other
+// candidates come before the branches they were built on, keeping the
+// existing order between unrelated branches.
+//
+// This is a best-effort heuristic: a branch is treated as stacked on another
+// when the other's tip is an ancestor of its own, so a branch whose parent was
+// rebased or squash merged since is seen as unrelated. It runs git merge-base
+// for every pair of candidates, which gets slow with thousands of branches.
+func sortTopologically(ctx context.Context, candidates []branchCandidate) error {
+	descendants := make(map[string]int, len(candidates))
+	for _, ancestor := range candidates {
+		for _, candidate := range candidates {
+			if candidate == ancestor {
+				continue
+			}
+			contained, err := isAncestor(ctx, ancestor.ref(), candidate.ref())
+			if err != nil {
+				return err
+			}
+			if contained {
+				descendants[ancestor.String()]++
+			}
+		}
+	}
+	// A branch always has fewer descendants among the candidates than any
+	// branch it was built on, so sorting by the count puts it first.
+	slices.SortStableFunc(candidates, func(a, b branchCandidate) int {
+		return descendants[a.String()] - descendants[b.String()]
+	})
+	return nil
+}
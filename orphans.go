@@ -0,0 +1,51 @@
+package main
+
+import "context"
+
+// findOrphanRemotes returns the remote-tracking branches of remote that no
+// longer exist on the remote itself, which git fetch --prune would remove.
+func findOrphanRemotes(ctx context.Context, remote string) (branches, error) {
+	tracked, err := getRemoteBranches(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	heads, err := getRemoteHeads(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	var orphans branches
+	for _, branch := range tracked {
+		if !heads[branch] {
+			orphans = append(orphans, branch)
+		}
+	}
+	return orphans, nil
+}
+
+// reportOrphanRemotes prints the stale remote-tracking branches of remote,
+// deleting them when prune is set and safeMode isn't.
+func reportOrphanRemotes(ctx context.Context, remote string, prune bool, safeMode bool) error {
+	orphans, err := findOrphanRemotes(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		logf("No stale remote-tracking branches for %s\n", remote)
+		return nil
+	}
+	logf("%d remote-tracking branches no longer exist on %s:\n", len(orphans), remote)
+	for _, branch := range orphans {
+		logf("  %s/%s\n", remote, branch)
+	}
+	if !prune || safeMode {
+		logf("Run git fetch --prune %s or use -prune-orphan-remotes to remove them\n", remote)
+		return nil
+	}
+	for _, branch := range orphans {
+		if _, err := commandOutput(gitCommand(ctx, "update-ref", "-d", "refs/remotes/"+remote+"/"+branch)); err != nil {
+			return err
+		}
+	}
+	logf("Removed %d stale remote-tracking branches\n", len(orphans))
+	return nil
+}
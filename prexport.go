@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const prExportVersion = 1
+
+// prExport is the file written by -pr-export and read by -pr-import, holding
+// the pull requests fetched for each head ref so other runs can reuse them
+// without querying Github. A head ref without pull requests maps to null.
+type prExport struct {
+	Version      int                     `json:"version"`
+	GeneratedAt  time.Time               `json:"generated_at"`
+	Repository   string                  `json:"repository"`
+	PullRequests map[string]pullRequests `json:"pull_requests"`
+}
+
+func newPrExport(owner string, repo string) *prExport {
+	return &prExport{
+		Version:      prExportVersion,
+		GeneratedAt:  time.Now().UTC(),
+		Repository:   owner + "/" + repo,
+		PullRequests: make(map[string]pullRequests),
+	}
+}
+
+func (e *prExport) JSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(e)
+}
+
+// loadPrExport reads a -pr-import file, rejecting one for another repository,
+// in an unknown format or generated longer than maxAge ago.
+func loadPrExport(filePath string, owner string, repo string, maxAge time.Duration) (*prExport, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var imported prExport
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filePath, err)
+	}
+	if imported.Version != prExportVersion || imported.PullRequests == nil {
+		return nil, fmt.Errorf("%s isn't a version %d -pr-export file", filePath, prExportVersion)
+	}
+	if imported.Repository != owner+"/"+repo {
+		return nil, fmt.Errorf("%s was exported for %s, not %s/%s", filePath, imported.Repository, owner, repo)
+	}
+	if age := time.Since(imported.GeneratedAt); maxAge > 0 && age > maxAge {
+		return nil, fmt.Errorf("%s was exported %v ago, older than -pr-import-max-age %v", filePath, age.Round(time.Minute), maxAge)
+	}
+	return &imported, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// pushPermissions are the repository permissions that allow pushing, and so
+// deleting remote branches.
+var pushPermissions = []githubv4.RepositoryPermission{
+	githubv4.RepositoryPermissionWrite,
+	githubv4.RepositoryPermissionMaintain,
+	githubv4.RepositoryPermissionAdmin,
+}
+
+// probe checks the token works and reports who it authenticates as and what
+// it may do in the repository, without touching any branches.
+func probe(ctx context.Context, client graphqlQuerier, owner string, repo string) error {
+	var query struct {
+		Viewer struct {
+			Login string
+		}
+		Repository struct {
+			NameWithOwner    string
+			ViewerPermission githubv4.RepositoryPermission
+			IsArchived       bool
+		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
+	}
+	variables := map[string]interface{}{
+		"repositoryOwner": githubv4.String(owner),
+		"repositoryName":  githubv4.String(repo),
+	}
+	if err := client.Query(ctx, &query, variables); err != nil {
+		return err
+	}
+
+	logf("Authenticated as %s\n", query.Viewer.Login)
+	logf("Repository %s is accessible with %s permission\n", query.Repository.NameWithOwner, query.Repository.ViewerPermission)
+	switch {
+	case query.Repository.IsArchived:
+		logf("The repository is archived, so remote branches can't be deleted\n")
+	case slices.Contains(pushPermissions, query.Repository.ViewerPermission):
+		logf("Remote branches can be deleted\n")
+	default:
+		logf("Remote branches can't be deleted, that needs write permission\n")
+	}
+	return nil
+}
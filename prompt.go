@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptTimeout is how long confirm waits for an answer before treating the
+// question as declined. Zero waits indefinitely.
+var promptTimeout time.Duration
+
+// promptDefault is the answer confirm gives when Enter is pressed without
+// typing anything. EOF and timeouts are always no.
+var promptDefault bool
+
+type stdinLine struct {
+	text string
+	err  error
+}
+
+// pendingLine holds a read that was still waiting when a prompt timed out, so
+// the next prompt receives that line instead of racing a second reader.
+var pendingLine <-chan stdinLine
+
+func readStdinLine() <-chan stdinLine {
+	if pendingLine == nil {
+		line := make(chan stdinLine, 1)
+		go func() {
+			text, err := stdinReader.ReadString('\n')
+			line <- stdinLine{text: text, err: err}
+		}()
+		pendingLine = line
+	}
+	return pendingLine
+}
+
+// confirm asks a yes/no question on stdin, treating anything other than an
+// explicit yes, including EOF or no answer within promptTimeout, as no. An
+// empty answer is promptDefault.
+func confirm(question string) bool {
+	choices := "[y/N]"
+	if promptDefault {
+		choices = "[Y/n]"
+	}
+	logf("%s %s: ", question, choices)
+
+	var timeout <-chan time.Time
+	if promptTimeout > 0 {
+		timer := time.NewTimer(promptTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var line stdinLine
+	select {
+	case line = <-readStdinLine():
+		pendingLine = nil
+	case <-timeout:
+		logf("\nNo answer after %v, treating it as no\n", promptTimeout)
+		return false
+	}
+	if line.err != nil && line.text == "" {
+		logf("\n")
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line.text)) {
+	case "y", "yes":
+		return true
+	case "":
+		return promptDefault && line.err == nil
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// protectionReason returns why a line of `git branch -l` output is never
+// deleted, or an empty string if it would be evaluated. The branch name is
+// empty for lines that aren't branches, such as a detached HEAD.
+func protectionReason(ctx context.Context, branchVal string, defaultBranch string, protectedBranches []string, matcher branchMatcher, checkTags bool) (string, string, error) {
+	if worktreeBranch, ok := strings.CutPrefix(branchVal, "+ "); ok {
+		return strings.TrimSpace(worktreeBranch), "checked out in another worktree", nil
+	}
+	current := strings.HasPrefix(branchVal, "* ")
+	branch := strings.TrimSpace(strings.TrimPrefix(branchVal, "* "))
+	if branch == "" || strings.HasPrefix(branch, "(") {
+		return "", "", nil
+	}
+	switch {
+	case branch == defaultBranch:
+		return branch, "default branch", nil
+	case slices.Contains(protectedBranches, branch):
+		return branch, "listed with -protect-branch", nil
+	case !matcher.matches(branch):
+		return branch, "excluded by -match", nil
+	case current:
+		return branch, "currently checked out", nil
+	}
+	if err := checkBranchName(branch); err != nil {
+		return branch, err.Error(), nil
+	}
+	if checkTags {
+		tags, err := getTagsPointingAt(ctx, branch)
+		if err != nil {
+			return "", "", err
+		}
+		if len(tags) > 0 {
+			return branch, fmt.Sprintf("tagged %s", strings.Join(tags, ", ")), nil
+		}
+	}
+	return branch, "", nil
+}
+
+// listProtectedBranches prints every local branch that would be skipped by the
+// protection rules, with the reason it is protected.
+func listProtectedBranches(ctx context.Context, branchList branches, defaultBranch string, protectedBranches []string, matcher branchMatcher, checkTags bool) error {
+	protected := newTable("BRANCH", "REASON")
+	for _, branchVal := range branchList {
+		branch, reason, err := protectionReason(ctx, branchVal, defaultBranch, protectedBranches, matcher, checkTags)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			protected.add(branch, reason)
+		}
+	}
+	return protected.render(logOutput, outputWidth(logOutput))
+}
+
+// migrationTwin returns the other name of a trunk being renamed between master
+// and main, or an empty string for any other default branch.
+func migrationTwin(defaultBranch string) string {
+	switch defaultBranch {
+	case "main":
+		return "master"
+	case "master":
+		return "main"
+	}
+	return ""
+}
+
+// migrationGuard returns the protected branches with the twin of the default
+// branch added while master is renamed to main, or back. The old trunk often
+// still exists, locally or on the remote, and shouldn't be deleted before the
+// migration is finished. It's merged into the new default branch, so nothing
+// else would keep it.
+func migrationGuard(ctx context.Context, defaultBranch string, remote string, protectedBranches []string, disabled bool) ([]string, error) {
+	twin := migrationTwin(defaultBranch)
+	if twin == "" || disabled || slices.Contains(protectedBranches, twin) {
+		return protectedBranches, nil
+	}
+	for _, ref := range []string{"refs/heads/" + twin, "refs/remotes/" + remote + "/" + twin} {
+		exists, err := refExists(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s: %w", ref, err)
+		}
+		if exists {
+			logf("Warning: both %s and %s exist, protecting %s as well (use -no-migration-guard to evaluate it)\n", defaultBranch, strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/remotes/"), twin)
+			return append(protectedBranches, twin), nil
+		}
+	}
+	return protectedBranches, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrationTwin(t *testing.T) {
+	tests := map[string]string{
+		"main":    "master",
+		"master":  "main",
+		"develop": "",
+		"trunk":   "",
+	}
+	for defaultBranch, want := range tests {
+		if got := migrationTwin(defaultBranch); got != want {
+			t.Errorf("migrationTwin(%q) = %q, want %q", defaultBranch, got, want)
+		}
+	}
+}
+
+// newTestRepo creates a git repository with a single commit on main and makes
+// it the working directory for the rest of the test.
+func newTestRepo(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	runGit(t, "init", "--quiet", "--initial-branch=main")
+	runGit(t, "commit", "--quiet", "--allow-empty", "--message=init")
+}
+
+func runGit(t *testing.T, args ...string) {
+	t.Helper()
+	if output, err := gitCommand(context.Background(), args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+}
+
+func TestMigrationGuard(t *testing.T) {
+	newTestRepo(t)
+	runGit(t, "branch", "master")
+	runGit(t, "update-ref", "refs/remotes/origin/main", "HEAD")
+	runGit(t, "update-ref", "refs/remotes/upstream/develop", "HEAD")
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		defaultBranch string
+		remote        string
+		protected     []string
+		disabled      bool
+		want          []string
+	}{
+		{name: "local twin", defaultBranch: "main", remote: "origin", protected: []string{"develop"}, want: []string{"develop", "master"}},
+		{name: "renamed back to master", defaultBranch: "master", remote: "upstream", want: []string{"main"}},
+		{name: "already protected", defaultBranch: "main", remote: "origin", protected: []string{"master"}, want: []string{"master"}},
+		{name: "disabled", defaultBranch: "main", remote: "origin", disabled: true, want: nil},
+		{name: "not a trunk rename", defaultBranch: "develop", remote: "upstream", want: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := migrationGuard(ctx, test.defaultBranch, test.remote, test.protected, test.disabled)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("migrationGuard() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMigrationGuardWithoutTwin(t *testing.T) {
+	newTestRepo(t)
+	runGit(t, "update-ref", "refs/remotes/origin/main", "HEAD")
+
+	got, err := migrationGuard(context.Background(), "main", "origin", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("migrationGuard() = %q without a master branch, want none", got)
+	}
+}
+
+func TestMigrationGuardRemoteTwinOnly(t *testing.T) {
+	newTestRepo(t)
+	runGit(t, "update-ref", "refs/remotes/origin/master", "HEAD")
+
+	got, err := migrationGuard(context.Background(), "main", "origin", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"master"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("migrationGuard() = %q with only origin/master, want %q", got, want)
+	}
+}
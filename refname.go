@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkBranchName reports why a branch name breaks git's ref name rules (see
+// git check-ref-format), or nil if it is valid. Names are checked before they
+// are passed to git or used in links, so a name such as -foo can't be taken
+// for an option.
+func checkBranchName(name string) error {
+	switch {
+	case name == "" || name == "@":
+		return fmt.Errorf("%q is not a valid branch name", name)
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("branch name %q starts with -", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("branch name %q contains ..", name)
+	case strings.Contains(name, "@{"):
+		return fmt.Errorf("branch name %q contains @{", name)
+	case strings.Contains(name, "//") || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return fmt.Errorf("branch name %q has an empty path component", name)
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("branch name %q ends with .", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("branch name %q contains the character %q", name, r)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("branch name %q has the invalid component %q", name, component)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestCheckBranchName(t *testing.T) {
+	valid := []string{
+		"main",
+		"feature/login",
+		"dependabot/npm_and_yarn/lodash-4.17.21",
+		"user@example",
+		"v1.2",
+		"a-",
+	}
+	for _, name := range valid {
+		if err := checkBranchName(name); err != nil {
+			t.Errorf("checkBranchName(%q) error = %v, want it to be valid", name, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"@",
+		"-foo",
+		"--force",
+		"feature..login",
+		"main@{1}",
+		"feature//login",
+		"/feature",
+		"feature/",
+		"feature.",
+		"feature login",
+		"feature~1",
+		"feature^",
+		"feature:login",
+		"feature?",
+		"feature*",
+		"feature[1]",
+		"feature\\login",
+		"feature\x00login",
+		"feature\x7f",
+		".hidden",
+		"feature/.hidden",
+		"feature.lock",
+		"feature.lock/login",
+	}
+	for _, name := range invalid {
+		if err := checkBranchName(name); err == nil {
+			t.Errorf("checkBranchName(%q) = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const releasesPerPage = 100
+
+// getDraftReleaseTargets returns a map of branch name to draft release name
+// for every draft release targeting a branch. The GraphQL API doesn't expose a
+// release's target commitish, so this uses the REST releases endpoint.
+func getDraftReleaseTargets(ctx context.Context, httpClient *http.Client, restURL string, owner string, repo string) (map[string]string, error) {
+	type release struct {
+		Name            string `json:"name"`
+		TagName         string `json:"tag_name"`
+		Draft           bool   `json:"draft"`
+		TargetCommitish string `json:"target_commitish"`
+	}
+
+	targets := make(map[string]string)
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d&page=%d", restURL, owner, repo, releasesPerPage, page)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var releases []release
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("listing releases: %s", resp.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range releases {
+			if !r.Draft || r.TargetCommitish == "" {
+				continue
+			}
+			name := r.Name
+			if name == "" {
+				name = r.TagName
+			}
+			targets[r.TargetCommitish] = name
+		}
+		if len(releases) < releasesPerPage {
+			return targets, nil
+		}
+	}
+}
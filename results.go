@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type branchResult struct {
+	RunID  string   `json:"run_id,omitempty"`
+	Branch string   `json:"branch"`
+	Action string   `json:"action"`
+	Reason string   `json:"reason"`
+	PRUrls []string `json:"pr_urls,omitempty"`
+
+	OpenPRUrls   []string `json:"open_pr_urls,omitempty"`
+	ClosedPRUrls []string `json:"closed_pr_urls,omitempty"`
+
+	// Commit and Upstream are the tip and tracked remote branch of a deleted
+	// local branch, recorded with -recreate-tracking so it can be restored.
+	Commit   string `json:"commit,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+
+	Info *branchInfo `json:"info,omitempty"`
+
+	// Comparison describes how the branch changed since a previous run, when
+	// comparing against one with -compare.
+	Comparison string `json:"comparison,omitempty"`
+}
+
+const (
+	comparisonNew            = "new"
+	comparisonStillKept      = "still-kept"
+	comparisonNewlyDeletable = "newly-deletable"
+	comparisonStillDeletable = "still-deletable"
+)
+
+// resultsFile is the JSON document written by -output and read by -compare.
+type resultsFile struct {
+	RunID       string         `json:"run_id,omitempty"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Results     []branchResult `json:"results"`
+
+	// OpenPullRequests is written with -output-open-prs-only.
+	OpenPullRequests []openPullRequest `json:"open_pull_requests,omitempty"`
+}
+
+// openPullRequest is an open pull request keeping one or more branches.
+type openPullRequest struct {
+	Number   int      `json:"number"`
+	Title    string   `json:"title"`
+	Author   string   `json:"author"`
+	URL      string   `json:"url"`
+	Branches []string `json:"branches"`
+}
+
+// runResults collects the decision made for each branch, streaming each one
+// to the event log as it's recorded.
+type runResults struct {
+	runID   string
+	events  *eventLog
+	linker  prLinker
+	trace   *decisionTrace
+	infos   map[string]branchInfo
+	openPRs map[int]*openPullRequest
+	counts  map[string]int
+	Results []branchResult
+
+	// keptReasons counts kept branches by their reason for -metrics.
+	keptReasons map[string]int
+
+	// stream, when set, receives each result as a JSON line instead of it being
+	// kept in Results, so memory use doesn't grow with the number of branches.
+	stream *json.Encoder
+
+	// includeOpenPRs adds the open pull requests to the JSON output.
+	includeOpenPRs bool
+}
+
+// record adds the decision for a branch, along with links to its pull
+// requests. prs is nil when the decision was made before they were fetched.
+func (r *runResults) record(branch string, action string, reason string, prs pullRequests) {
+	r.recordTracked(branch, action, reason, prs, "", "")
+}
+
+// recordTracked is record for a deleted branch, also keeping the commit and
+// upstream it had, which are empty unless -recreate-tracking is set.
+func (r *runResults) recordTracked(branch string, action string, reason string, prs pullRequests, commit string, upstream string) {
+	r.events.record(branch, action, reason)
+	r.trace.print(branch, action, reason)
+	result := branchResult{
+		RunID:    r.runID,
+		Branch:   branch,
+		Action:   action,
+		Reason:   reason,
+		Commit:   commit,
+		Upstream: upstream,
+	}
+	if info, ok := r.infos[branch]; ok {
+		result.Info = &info
+	}
+	if len(prs) > 0 {
+		result.PRUrls = prs.getPrUrls(r.linker)
+		result.OpenPRUrls = prs.getOpenPrUrls(r.linker)
+		result.ClosedPRUrls = prs.getClosedPrUrls(r.linker)
+	}
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+	r.counts[action]++
+	if action == actionKept {
+		if r.keptReasons == nil {
+			r.keptReasons = make(map[string]int)
+		}
+		r.keptReasons[metricReason(reason)]++
+	}
+	if r.stream != nil {
+		if err := r.stream.Encode(result); err != nil {
+			logf("Failed to write result for branch %s: %v\n", branch, err)
+		}
+		return
+	}
+	r.addOpenPRs(branch, prs)
+	r.Results = append(r.Results, result)
+}
+
+// count returns the number of branches recorded with any of the actions,
+// including streamed results.
+func (r *runResults) count(actions ...string) int {
+	total := 0
+	for _, action := range actions {
+		total += r.counts[action]
+	}
+	return total
+}
+
+// JSON writes the results as an indented JSON document, readable by -compare.
+func (r *runResults) JSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	file := resultsFile{RunID: r.runID, GeneratedAt: time.Now().UTC(), Results: r.Results}
+	if r.includeOpenPRs {
+		file.OpenPullRequests = r.openPullRequests()
+	}
+	return encoder.Encode(file)
+}
+
+func (r *runResults) addOpenPRs(branch string, prs pullRequests) {
+	for _, pr := range prs {
+		if pr.State != "OPEN" {
+			continue
+		}
+		if r.openPRs == nil {
+			r.openPRs = make(map[int]*openPullRequest)
+		}
+		open, ok := r.openPRs[pr.Number]
+		if !ok {
+			open = &openPullRequest{Number: pr.Number, Title: pr.Title, URL: r.linker.url(pr.Number)}
+			if pr.Author != nil {
+				open.Author = pr.Author.Login
+			}
+			r.openPRs[pr.Number] = open
+		}
+		if !slices.Contains(open.Branches, branch) {
+			open.Branches = append(open.Branches, branch)
+		}
+	}
+}
+
+// openPullRequests returns the open pull requests seen across every branch,
+// sorted by number.
+func (r *runResults) openPullRequests() []openPullRequest {
+	open := make([]openPullRequest, 0, len(r.openPRs))
+	for _, pr := range r.openPRs {
+		open = append(open, *pr)
+	}
+	slices.SortFunc(open, func(a, b openPullRequest) int {
+		return a.Number - b.Number
+	})
+	return open
+}
+
+// Text writes the results as an aligned plain text table followed by totals.
+func (r *runResults) Text(w io.Writer) error {
+	report := newTable("BRANCH", "ACTION", "AUTHOR", "LAST COMMIT", "AHEAD", "BEHIND", "REASON")
+	for _, result := range r.Results {
+		author, lastCommit, ahead, behind := "-", "-", "-", "-"
+		if info := result.Info; info != nil {
+			author = info.Author
+			lastCommit = info.LastCommit.Format(time.DateOnly)
+			ahead = strconv.Itoa(info.Ahead)
+			behind = strconv.Itoa(info.Behind)
+		}
+		report.add(result.Branch, result.Action, author, lastCommit, ahead, behind, result.Reason)
+	}
+	if err := report.render(w, outputWidth(w)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", r.totals())
+	return err
+}
+
+// CSV writes one row per branch with its action, reason and the open and
+// closed pull request links, each list joined with semicolons.
+func (r *runResults) CSV(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"branch", "action", "reason", "open_prs", "closed_prs"})
+	for _, result := range r.Results {
+		csvWriter.Write([]string{
+			result.Branch,
+			result.Action,
+			result.Reason,
+			strings.Join(result.OpenPRUrls, ";"),
+			strings.Join(result.ClosedPRUrls, ";"),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func (r *runResults) totals() string {
+	return fmt.Sprintf("%d deleted, %d would delete, %d kept, %d errors",
+		r.count(actionDeleted), r.count(actionWouldDelete), r.count(actionKept), r.count(actionError))
+}
+
+// writeResultsFile renders the results into the file at filePath using one of
+// the report formats.
+func writeResultsFile(filePath string, render func(io.Writer) error) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := render(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func loadResultsFile(filePath string) (*resultsFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var previous resultsFile
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filePath, err)
+	}
+	return &previous, nil
+}
+
+// compare annotates each result with how it changed relative to a previous
+// run and returns the number of results with each comparison.
+func (r *runResults) compare(previous *resultsFile) map[string]int {
+	previousActions := make(map[string]string, len(previous.Results))
+	for _, result := range previous.Results {
+		previousActions[result.Branch] = result.Action
+	}
+
+	counts := make(map[string]int)
+	for i, result := range r.Results {
+		previousAction, seen := previousActions[result.Branch]
+		wasDeletable := previousAction == actionDeleted || previousAction == actionWouldDelete
+		isDeletable := result.Action == actionDeleted || result.Action == actionWouldDelete
+		switch {
+		case !seen:
+			result.Comparison = comparisonNew
+		case isDeletable && wasDeletable:
+			result.Comparison = comparisonStillDeletable
+		case isDeletable:
+			result.Comparison = comparisonNewlyDeletable
+		default:
+			result.Comparison = comparisonStillKept
+		}
+		r.Results[i] = result
+		counts[result.Comparison]++
+	}
+	return counts
+}
+
+func (r *runResults) withAction(actions ...string) []branchResult {
+	var matching []branchResult
+	for _, result := range r.Results {
+		for _, action := range actions {
+			if result.Action == action {
+				matching = append(matching, result)
+				break
+			}
+		}
+	}
+	return matching
+}
+
+// Markdown writes the results as a GitHub-flavored Markdown report.
+func (r *runResults) Markdown(w io.Writer) error {
+	deleted := r.withAction(actionDeleted, actionWouldDelete)
+	kept := r.withAction(actionKept)
+	errored := r.withAction(actionError)
+
+	var sb strings.Builder
+	sb.WriteString("# Branch cleanup summary\n\n")
+	fmt.Fprintf(&sb, "- **Run ID:** %s\n", markdownCode(r.runID))
+	fmt.Fprintf(&sb, "- **Deleted:** %d\n", len(r.withAction(actionDeleted)))
+	fmt.Fprintf(&sb, "- **Would delete (safe mode):** %d\n", len(r.withAction(actionWouldDelete)))
+	fmt.Fprintf(&sb, "- **Kept:** %d\n", len(kept))
+	fmt.Fprintf(&sb, "- **Errors:** %d\n", len(errored))
+
+	if len(deleted) > 0 {
+		sb.WriteString("\n## Deleted branches\n\n")
+		sb.WriteString("| Branch | Pull requests |\n| --- | --- |\n")
+		for _, result := range deleted {
+			branch := markdownCode(result.Branch)
+			if result.Action == actionWouldDelete {
+				branch += " (safe mode)"
+			}
+			fmt.Fprintf(&sb, "| %s | %s |\n", branch, markdownPrLinks(result.PRUrls))
+		}
+	}
+	for _, section := range []struct {
+		title   string
+		results []branchResult
+	}{{"Kept branches", kept}, {"Errors", errored}} {
+		if len(section.results) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n", section.title)
+		sb.WriteString("| Branch | Reason | Pull requests |\n| --- | --- | --- |\n")
+		for _, result := range section.results {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", markdownCode(result.Branch), markdownEscape(result.Reason), markdownPrLinks(result.PRUrls))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func markdownPrLinks(prUrls []string) string {
+	links := make([]string, 0, len(prUrls))
+	for _, prUrl := range prUrls {
+		links = append(links, fmt.Sprintf("[#%s](%s)", path.Base(prUrl), prUrl))
+	}
+	return strings.Join(links, ", ")
+}
+
+func markdownCode(value string) string {
+	return "`" + strings.ReplaceAll(value, "|", "\\|") + "`"
+}
+
+func markdownEscape(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
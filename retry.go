@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// graphqlQuerier is the subset of *githubv4.Client used to run queries.
+type graphqlQuerier interface {
+	Query(ctx context.Context, q interface{}, variables map[string]interface{}) error
+}
+
+// retryingClient retries queries that fail with transient network errors,
+// using exponential backoff with jitter. Errors returned by the API itself,
+// such as validation or authentication failures, are returned immediately.
+// Each attempt is cancelled after queryTimeout, if set, and retried like a
+// network error.
+type retryingClient struct {
+	client       *githubv4.Client
+	retries      int
+	baseDelay    time.Duration
+	queryTimeout time.Duration
+	verbose      bool
+
+	// stats, when set, is waited on before the query timeout starts, so a
+	// pause for the rate limit to reset isn't cut short by it.
+	stats   *apiStats
+	reserve int
+
+	// refresh, when set, is called on the first authentication failure to get a
+	// client with a new token, for gh tokens that expire during a long run. It's
+	// only ever tried once.
+	refresh   func() (*githubv4.Client, error)
+	refreshed bool
+}
+
+func (c *retryingClient) Query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.query(ctx, q, variables)
+		if err != nil && c.refresh != nil && !c.refreshed && isAuthError(err) {
+			c.refreshed = true
+			if c.verbose {
+				logf("Github rejected the token, refreshing it with gh auth token: %v\n", err)
+			}
+			client, refreshErr := c.refresh()
+			if refreshErr != nil {
+				logf("Failed to refresh the Github token: %v\n", refreshErr)
+				return err
+			}
+			c.client = client
+			err = c.query(ctx, q, variables)
+		}
+		if err == nil || attempt >= c.retries || !isNetworkError(ctx, err) {
+			return err
+		}
+		delay := backoffDelay(c.baseDelay, attempt)
+		logf("Network error querying Github, retrying in %v (%d/%d): %v\n", delay.Round(time.Millisecond), attempt+1, c.retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+var errQueryTimeout = errors.New("query timed out")
+
+func (c *retryingClient) query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
+	if c.queryTimeout <= 0 {
+		return c.client.Query(ctx, q, variables)
+	}
+	if c.stats != nil {
+		if err := c.stats.wait(ctx, c.reserve); err != nil {
+			return err
+		}
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+	err := c.client.Query(queryCtx, q, variables)
+	if err != nil && queryCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("%w after %v: %v", errQueryTimeout, c.queryTimeout, err)
+	}
+	return err
+}
+
+// isNetworkError reports whether the error came from the HTTP transport (DNS,
+// connection resets, TLS failures, timeouts) rather than from the API.
+func isNetworkError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, errQueryTimeout) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isAuthError reports whether the API rejected the request's credentials.
+// githubv4 only reports the status in the error message.
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "status code: 401 ")
+}
+
+// backoffDelay doubles the base delay for each attempt and picks a random
+// delay between half and all of it, so concurrent retries spread out.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << attempt
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// flakyTransport fails the first failures requests with a connection error,
+// then answers every request with body.
+type flakyTransport struct {
+	failures int
+	body     string
+	requests int
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	if t.requests <= t.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+type viewerQuery struct {
+	Viewer struct {
+		Login githubv4.String
+	}
+}
+
+func newFlakyClient(transport *flakyTransport, retries int) *retryingClient {
+	httpClient := &http.Client{Transport: transport}
+	return &retryingClient{
+		client:    githubv4.NewClient(httpClient),
+		retries:   retries,
+		baseDelay: time.Millisecond,
+	}
+}
+
+func TestRetryingClientRetriesNetworkErrors(t *testing.T) {
+	transport := &flakyTransport{failures: 2, body: `{"data":{"viewer":{"login":"octocat"}}}`}
+	client := newFlakyClient(transport, 3)
+
+	var query viewerQuery
+	if err := client.Query(context.Background(), &query, nil); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if query.Viewer.Login != "octocat" {
+		t.Errorf("Query() login = %q, want octocat", query.Viewer.Login)
+	}
+	if transport.requests != 3 {
+		t.Errorf("Query() made %d requests, want 3", transport.requests)
+	}
+}
+
+func TestRetryingClientGivesUpAfterRetries(t *testing.T) {
+	transport := &flakyTransport{failures: 5, body: `{"data":{"viewer":{"login":"octocat"}}}`}
+	client := newFlakyClient(transport, 2)
+
+	var query viewerQuery
+	err := client.Query(context.Background(), &query, nil)
+	if err == nil {
+		t.Fatal("Query() succeeded, want the network error")
+	}
+	if !isNetworkError(context.Background(), err) {
+		t.Errorf("Query() error = %v, want a network error", err)
+	}
+	if transport.requests != 3 {
+		t.Errorf("Query() made %d requests, want 3", transport.requests)
+	}
+}
+
+func TestRetryingClientDoesNotRetryAPIErrors(t *testing.T) {
+	transport := &flakyTransport{body: `{"errors":[{"message":"Field 'viewer' doesn't exist"}]}`}
+	client := newFlakyClient(transport, 3)
+
+	var query viewerQuery
+	if err := client.Query(context.Background(), &query, nil); err == nil {
+		t.Fatal("Query() succeeded, want the API error")
+	}
+	if transport.requests != 1 {
+		t.Errorf("Query() made %d requests, want 1", transport.requests)
+	}
+}
+
+func TestIsNetworkError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	networkErr := &url.Error{Op: "Post", URL: "https://api.github.com/graphql", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{name: "transport error", ctx: context.Background(), err: networkErr, want: true},
+		{name: "query timeout", ctx: context.Background(), err: errQueryTimeout, want: true},
+		{name: "api error", ctx: context.Background(), err: errors.New("Field 'viewer' doesn't exist"), want: false},
+		{name: "cancelled", ctx: cancelled, err: networkErr, want: false},
+	}
+	for _, test := range tests {
+		if got := isNetworkError(test.ctx, test.err); got != test.want {
+			t.Errorf("isNetworkError(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// safetyCheck guards against deleting a branch whose deletion could lose work,
+// even when its pull requests say it's safe. Check returns a reason to keep the
+// branch, or an empty string if the check passes.
+type safetyCheck struct {
+	Name  string
+	Check func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error)
+}
+
+// runSafetyChecks returns the reason given by the first failing check, if any.
+func runSafetyChecks(ctx context.Context, checks []safetyCheck, candidate branchCandidate, prs pullRequests) (string, error) {
+	for _, check := range checks {
+		reason, err := check.Check(ctx, candidate, prs)
+		if err != nil {
+			return "", fmt.Errorf("%s check: %w", check.Name, err)
+		}
+		if reason != "" {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+func taggedSafetyCheck() safetyCheck {
+	return safetyCheck{
+		Name: "tagged",
+		Check: func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error) {
+			tags, err := getTagsPointingAt(ctx, candidate.ref())
+			if err != nil || len(tags) == 0 {
+				return "", err
+			}
+			return fmt.Sprintf("tagged as %s", strings.Join(tags, ", ")), nil
+		},
+	}
+}
+
+func remoteActivitySafetyCheck(remote string, window time.Duration) safetyCheck {
+	return safetyCheck{
+		Name: "remote activity",
+		Check: func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error) {
+			active, reason, err := isRemoteBranchActive(ctx, remote, candidate.Name, window)
+			if err != nil || !active {
+				return "", err
+			}
+			return reason, nil
+		},
+	}
+}
+
+// stashSafetyCheck keeps local branches that stash entries were made on, since
+// the stashed work usually belongs with the branch.
+func stashSafetyCheck(stashes map[string][]string) safetyCheck {
+	return safetyCheck{
+		Name: "stashes",
+		Check: func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error) {
+			refs := stashes[candidate.Name]
+			if candidate.Remote != "" || len(refs) == 0 {
+				return "", nil
+			}
+			return fmt.Sprintf("stashed in %s", strings.Join(refs, ", ")), nil
+		},
+	}
+}
+
+func aheadOfUpstreamSafetyCheck() safetyCheck {
+	return safetyCheck{
+		Name: "ahead of upstream",
+		Check: func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error) {
+			if candidate.Remote != "" {
+				return "", nil
+			}
+			upstream, err := getUpstream(ctx, candidate.Name)
+			if err != nil || upstream == "" {
+				return "", err
+			}
+			ahead, err := countCommitsAhead(ctx, candidate.Name, upstream)
+			if err != nil || ahead == 0 {
+				return "", err
+			}
+			return fmt.Sprintf("ahead of %s by %d unpushed commits", upstream, ahead), nil
+		},
+	}
+}
+
+// unpushedSafetyCheck keeps local branches with commits that aren't on any
+// remote branch, wherever they were pushed, so deleting them can't lose work.
+// A tip that's the head of one of the branch's pull requests is on Github even
+// once its remote branch is deleted, as happens after a squash merge.
+func unpushedSafetyCheck() safetyCheck {
+	return safetyCheck{
+		Name: "unpushed",
+		Check: func(ctx context.Context, candidate branchCandidate, prs pullRequests) (string, error) {
+			if candidate.Remote != "" {
+				return "", nil
+			}
+			tip, err := getCommit(ctx, candidate.ref())
+			if err != nil {
+				return "", err
+			}
+			for _, pr := range prs {
+				if string(pr.HeadRefOid) == tip {
+					return "", nil
+				}
+			}
+			orphans, err := countCommitsNotOnRemotes(ctx, candidate.ref())
+			if err != nil || orphans == 0 {
+				return "", err
+			}
+			return fmt.Sprintf("%d commits not on any remote branch", orphans), nil
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const lastRunFileName = "delete-old-branches-last-run"
+
+// lastRunPath returns the file in the shared git directory that records when
+// the tool last completed a run that could delete branches.
+func lastRunPath() (string, error) {
+	gitDir, err := findGitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(commonGitDir(gitDir), lastRunFileName), nil
+}
+
+// readLastRun returns the recorded time of the last successful run, or the
+// zero time if none has been recorded.
+func readLastRun() (time.Time, error) {
+	path, err := lastRunPath()
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+}
+
+func writeLastRun(t time.Time) error {
+	path, err := lastRunPath()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(t.UTC().Format(time.RFC3339)+"\n"), 0644)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// scanNul is a bufio.SplitFunc splitting input into NUL terminated records,
+// with a final unterminated record allowed.
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readNulSeparated reads NUL separated branch names, as printed by
+// git for-each-ref --format='%(refname:short)%00'. That format still ends every
+// record with a newline, so one leading newline is dropped from each name;
+// git never allows control characters in ref names.
+func readNulSeparated(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanNul)
+	var names []string
+	for scanner.Scan() {
+		name := strings.TrimPrefix(scanner.Text(), "\n")
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// fallbackTableWidth is used for tables written to a stream that isn't a
+// terminal, so piped output is stable.
+const fallbackTableWidth = 120
+
+// minTruncatedWidth is the narrowest the first column is truncated to when a
+// table doesn't fit.
+const minTruncatedWidth = 12
+
+// table renders rows as aligned columns separated by two spaces.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// render writes the table. The last column may run past the width, but when
+// width is positive and the other columns alone don't fit, values in the first
+// column, usually branch names, are truncated with an ellipsis.
+func (t *table) render(w io.Writer, width int) error {
+	widths := make([]int, len(t.header))
+	for _, row := range append([][]string{t.header}, t.rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	if total := tableWidth(widths[:len(widths)-1]); width > 0 && total > width && len(widths) > 1 {
+		widths[0] = max(widths[0]-(total-width), min(widths[0], minTruncatedWidth))
+	}
+
+	var sb strings.Builder
+	for _, row := range append([][]string{t.header}, t.rows...) {
+		for i, cell := range row {
+			if i == 0 {
+				cell = truncate(cell, widths[0])
+			}
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// tableWidth returns the width of the columns including the spacing after
+// each one.
+func tableWidth(widths []int) int {
+	total := 0
+	for _, width := range widths {
+		total += width + 2
+	}
+	return total
+}
+
+// truncate shortens s to at most width characters, ending it with an ellipsis
+// when anything was cut.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width < 1 {
+		return ""
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// outputWidth returns the width tables written to w should fit: the terminal's
+// width, or fallbackTableWidth when w isn't a terminal.
+func outputWidth(w io.Writer) int {
+	file, ok := w.(*os.File)
+	if !ok {
+		return fallbackTableWidth
+	}
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fallbackTableWidth
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if columns := terminalColumns(file); columns > 0 {
+		return columns
+	}
+	return fallbackTableWidth
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{s: "feature/login", width: 20, want: "feature/login"},
+		{s: "feature/login", width: 13, want: "feature/login"},
+		{s: "feature/login", width: 12, want: "feature/log…"},
+		{s: "feature/login", width: 1, want: "…"},
+		{s: "feature/login", width: 0, want: ""},
+		{s: "fix/überprüfung", width: 8, want: "fix/übe…"},
+	}
+	for _, test := range tests {
+		if got := truncate(test.s, test.width); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+	}
+}
+
+func TestTableRender(t *testing.T) {
+	newProtectedTable := func() *table {
+		protected := newTable("BRANCH", "REASON")
+		protected.add("feature/a-very-long-branch-name-indeed", "merged")
+		protected.add("short", "tagged as v1")
+		return protected
+	}
+
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{
+			name:  "fits",
+			width: 120,
+			want: "BRANCH                                  REASON\n" +
+				"feature/a-very-long-branch-name-indeed  merged\n" +
+				"short                                   tagged as v1\n",
+		},
+		{
+			name:  "no width",
+			width: 0,
+			want: "BRANCH                                  REASON\n" +
+				"feature/a-very-long-branch-name-indeed  merged\n" +
+				"short                                   tagged as v1\n",
+		},
+		{
+			name:  "truncated",
+			width: 30,
+			want: "BRANCH                        REASON\n" +
+				"feature/a-very-long-branch-…  merged\n" +
+				"short                         tagged as v1\n",
+		},
+		{
+			name:  "truncated to the minimum",
+			width: 10,
+			want: "BRANCH        REASON\n" +
+				"feature/a-v…  merged\n" +
+				"short         tagged as v1\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := newProtectedTable().render(&sb, test.width); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != test.want {
+				t.Errorf("render() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
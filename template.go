@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateReport is the data -template-file is executed with.
+type templateReport struct {
+	RunID            string
+	GeneratedAt      time.Time
+	Results          []branchResult
+	OpenPullRequests []openPullRequest
+	Deleted          int
+	WouldDelete      int
+	Kept             int
+	Errors           int
+}
+
+// templateFieldHelp documents templateReport for the help output.
+const templateFieldHelp = `  .RunID             the -run-id of the run
+  .GeneratedAt       time the report was rendered
+  .Deleted, .WouldDelete, .Kept, .Errors
+                     number of branches with each action
+  .Results           one per branch, each with:
+    .Branch, .Action, .Reason, .Comparison
+    .PRUrls, .OpenPRUrls, .ClosedPRUrls
+    .Commit, .Upstream (set with -recreate-tracking)
+    .Info              nil, or .Author, .LastCommit, .Ahead, .Behind
+  .OpenPullRequests  .Number, .Title, .Author, .URL, .Branches
+  The join function joins a list with a separator: {{join .PRUrls ", "}}
+`
+
+func loadReportTemplate(filePath string) (*template.Template, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filePath).Option("missingkey=error").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(string(data))
+}
+
+// Template executes a -template-file template once over every result.
+func (r *runResults) Template(w io.Writer, tmpl *template.Template) error {
+	return tmpl.Execute(w, templateReport{
+		RunID:            r.runID,
+		GeneratedAt:      time.Now().UTC(),
+		Results:          r.Results,
+		OpenPullRequests: r.openPullRequests(),
+		Deleted:          r.count(actionDeleted),
+		WouldDelete:      r.count(actionWouldDelete),
+		Kept:             r.count(actionKept),
+		Errors:           r.count(actionError),
+	})
+}
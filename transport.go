@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiStats records request counts and the latest rate limit headers seen on
+// Github API responses.
+type apiStats struct {
+	mu        sync.Mutex
+	requests  int
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func (s *apiStats) record(resp *http.Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	s.known = true
+	s.remaining = remaining
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		s.limit = limit
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		s.reset = time.Unix(reset, 0)
+	}
+}
+
+// pauseUntil returns when requests should resume if the remaining rate limit
+// is at or below reserve, or the zero time if there's no need to wait.
+func (s *apiStats) pauseUntil(reserve int) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.known || s.remaining > reserve || time.Now().After(s.reset) {
+		return time.Time{}
+	}
+	return s.reset
+}
+
+// wait pauses until the rate limit resets if the remaining limit is at or
+// below reserve.
+func (s *apiStats) wait(ctx context.Context, reserve int) error {
+	until := s.pauseUntil(reserve)
+	if until.IsZero() {
+		return nil
+	}
+	wait := time.Until(until)
+	logf("Github rate limit nearly exhausted, pausing %v until it resets...\n", wait.Round(time.Second))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (s *apiStats) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *apiStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.known {
+		return fmt.Sprintf("API requests: %d, rate limit: unknown", s.requests)
+	}
+	return fmt.Sprintf("API requests: %d, rate limit remaining: %d/%d, resets at %s",
+		s.requests, s.remaining, s.limit, s.reset.Local().Format(time.Kitchen))
+}
+
+// rateLimitTransport records rate limit headers from every response, and
+// pauses before sending a request once the remaining limit drops to the
+// reserve, rather than waiting for the API to reject requests.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	stats   *apiStats
+	reserve int
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.stats.wait(req.Context(), t.reserve); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.stats.record(resp)
+	return resp, nil
+}
+
+const maxTraceBody = 4096
+
+// traceTransport logs every request, with its headers, and response body to
+// stderr for debugging API issues. It sits below the oauth2 transport, which has
+// already set the Authorization header, so that header is logged redacted and
+// any occurrence of the token in a body is redacted as well.
+type traceTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		fmt.Fprintf(os.Stderr, "-> %s %s\n%s%s\n", req.Method, req.URL, traceHeaders(req.Header), t.redact(body))
+	} else {
+		fmt.Fprintf(os.Stderr, "-> %s %s\n%s", req.Method, req.URL, traceHeaders(req.Header))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "<- %v\n", err)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	fmt.Fprintf(os.Stderr, "<- %s\n%s\n", resp.Status, t.redact(body))
+	return resp, nil
+}
+
+// traceHeaders formats request headers one per line in name order, hiding the
+// value of any that carry credentials.
+func traceHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(header.Values(name), ", ")
+		if name == "Authorization" || name == "Proxy-Authorization" {
+			value = "[REDACTED]"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+	return b.String()
+}
+
+func (t *traceTransport) redact(body []byte) string {
+	text := string(body)
+	if t.token != "" {
+		text = strings.ReplaceAll(text, t.token, "[REDACTED]")
+	}
+	if len(text) > maxTraceBody {
+		text = fmt.Sprintf("%s... (%d bytes truncated)", text[:maxTraceBody], len(text)-maxTraceBody)
+	}
+	return text
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTraceHeadersRedactsCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret-token")
+	header.Set("Content-Type", "application/json")
+	header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+
+	got := traceHeaders(header)
+	want := "Authorization: [REDACTED]\nContent-Type: application/json\nProxy-Authorization: [REDACTED]\n"
+	if got != want {
+		t.Errorf("traceHeaders() = %q, want %q", got, want)
+	}
+	if strings.Contains(got, "secret") {
+		t.Errorf("traceHeaders() leaked a credential: %q", got)
+	}
+}
+
+func TestTraceTransportRedactsTokenInBody(t *testing.T) {
+	transport := &traceTransport{token: "secret-token"}
+	got := transport.redact([]byte(`{"token":"secret-token"}`))
+	if want := `{"token":"[REDACTED]"}`; got != want {
+		t.Errorf("redact() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+type flagGroup struct {
+	Name  string
+	Flags []string
+}
+
+// flagGroups controls how flags are grouped in the help output. Flags that
+// aren't listed here are printed under "Other" so they're never hidden.
+var flagGroups = []flagGroup{
+	{Name: "Selection", Flags: []string{"branch", "stdin0", "match", "include-remote-branches", "team-branches", "as", "prune-empty", "local-only", "reverse", "delete-order", "filter-pr-state", "ignore-fork-prs", "older-than", "newer-than", "since-last-run", "since-tag", "age-source", "age-fallback"}},
+	{Name: "Safety", Flags: []string{"safe", "dry-run-exit-code", "assert-clean", "ignore-error-branches", "fail-fast", "force", "delete-closed-older-than", "safe-delete", "bot-authors", "merged-policy", "min-age-merged", "force-unsafe", "ignore-tagged", "allow-ahead", "allow-unpushed", "ignore-stashes", "merge-commit-check", "require-passing-checks", "no-default-skip", "yes", "prompt-default", "prompt-timeout", "list-protected", "report-orphan-remotes", "prune-orphan-remotes", "default-from", "base-commit", "assume-default", "protect-branch", "no-migration-guard", "protect-path", "check-releases", "respect-remote-activity", "remote-activity-window", "unshallow", "recreate-tracking"}},
+	{Name: "Output", Flags: []string{"show-diffstat", "output", "output-format", "output-open-prs-only", "csv", "template-file", "stream", "summary-only", "compare", "summary-file", "metrics", "notify-webhook", "notify-on", "events", "run-id", "verbose", "explain"}},
+	{Name: "Hooks", Flags: []string{"pre-delete-check", "post-delete-hook", "hook-timeout"}},
+	{Name: "Configuration", Flags: []string{"config", "profile"}},
+	{Name: "Provider", Flags: []string{"probe", "token-from-file", "no-gh", "remote", "url-template", "strip-prefix", "branch-map"}},
+	{Name: "Performance", Flags: []string{"pr-export", "pr-import", "pr-import-max-age", "api-page-size", "pr-lookback", "dedupe-by-pr", "batch-delete", "query-timeout", "network-retries", "retry-delay", "rate-limit-reserve", "stats", "trace-http"}},
+}
+
+var usageExamples = []string{
+	"delete-old-branches -safe",
+	"delete-old-branches -safe -prune-empty",
+	"git for-each-ref --format='%(refname:short)%00' --merged main refs/heads | delete-old-branches -stdin0",
+	"delete-old-branches -force -match 'feature/*,!feature/keep-*'",
+	"delete-old-branches -older-than 720h -age-source merged",
+	"delete-old-branches -safe -filter-pr-state OPEN,NONE",
+	"delete-old-branches -older-than 24h -newer-than 168h",
+	"delete-old-branches -profile aggressive -safe",
+	"delete-old-branches -assert-clean -output stale.json",
+	"delete-old-branches -protect-branch develop -protect-branch staging",
+	"delete-old-branches -branch-map '^[^/]+/(.*)=$1'",
+	"delete-old-branches -safe -branch feature/login -branch fix/typo",
+	"delete-old-branches -include-remote-branches -- --no-verify",
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: delete-old-branches [flags] [-- git push options]\n\n")
+	fmt.Fprintf(out, "Deletes local branches whose Github pull requests have all been merged.\n")
+	fmt.Fprintf(out, "Options after -- are passed to the git push command that deletes each remote branch.\n")
+
+	grouped := make(map[string]bool)
+	for _, group := range flagGroups {
+		var groupFlags []*flag.Flag
+		for _, name := range group.Flags {
+			if f := flag.Lookup(name); f != nil {
+				groupFlags = append(groupFlags, f)
+				grouped[name] = true
+			}
+		}
+		printFlagGroup(group.Name, groupFlags)
+	}
+
+	var otherFlags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !grouped[f.Name] {
+			otherFlags = append(otherFlags, f)
+		}
+	})
+	printFlagGroup("Other", otherFlags)
+
+	fmt.Fprintf(out, "\nTemplate fields:\n%s", templateFieldHelp)
+
+	fmt.Fprintf(out, "\nExamples:\n")
+	for _, example := range usageExamples {
+		fmt.Fprintf(out, "  %s\n", example)
+	}
+}
+
+func printFlagGroup(name string, flags []*flag.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "\n%s:\n", name)
+	for _, f := range flags {
+		argName, help := flag.UnquoteUsage(f)
+		line := "  -" + f.Name
+		if argName != "" {
+			line += " " + argName
+		}
+		fmt.Fprintf(out, "%s\n    \t%s", line, strings.ReplaceAll(help, "\n", "\n    \t"))
+		if !isZeroFlagValue(f.DefValue) {
+			fmt.Fprintf(out, " (default %q)", f.DefValue)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+func isZeroFlagValue(value string) bool {
+	switch value {
+	case "", "0", "0s", "false", "[]":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	notifyAlways   = "always"
+	notifyOnDelete = "on-delete"
+	notifyOnError  = "on-error"
+)
+
+var notifyOnValues = []string{notifyAlways, notifyOnDelete, notifyOnError}
+
+const webhookTimeout = 10 * time.Second
+
+// webhookSummary is the JSON body posted by -notify-webhook. Text makes it
+// readable as a Slack incoming webhook message.
+type webhookSummary struct {
+	RunID      string         `json:"run_id"`
+	Text       string         `json:"text"`
+	Repository string         `json:"repository"`
+	Counts     map[string]int `json:"counts"`
+	Deleted    []string       `json:"deleted"`
+	Errors     []string       `json:"errors"`
+}
+
+func (r *runResults) webhookSummary() webhookSummary {
+	summary := webhookSummary{
+		RunID:      r.runID,
+		Repository: r.linker.owner + "/" + r.linker.repo,
+		Counts:     make(map[string]int),
+		Deleted:    make([]string, 0),
+		Errors:     make([]string, 0),
+	}
+	for _, result := range r.Results {
+		summary.Counts[result.Action]++
+		switch result.Action {
+		case actionDeleted, actionWouldDelete:
+			summary.Deleted = append(summary.Deleted, result.Branch)
+		case actionError:
+			summary.Errors = append(summary.Errors, result.Branch)
+		}
+	}
+	summary.Text = fmt.Sprintf("delete-old-branches on %s: %s", summary.Repository, r.totals())
+	return summary
+}
+
+// shouldNotify reports whether the run's results match the -notify-on filter.
+func (r *runResults) shouldNotify(notifyOn string) bool {
+	switch notifyOn {
+	case notifyOnDelete:
+		return r.count(actionDeleted, actionWouldDelete) > 0
+	case notifyOnError:
+		return r.count(actionError) > 0
+	}
+	return true
+}
+
+func postWebhook(webhookURL string, summary webhookSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	// Webhook URLs often embed a secret, so keep the URL out of errors.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}